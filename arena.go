@@ -0,0 +1,216 @@
+package msgpack
+
+import (
+	"reflect"
+)
+
+const defaultArenaChunkSize = 64 << 10
+
+// Arena allocates strings, byte slices, slices and maps decoded by
+// a Decoder in large chunks, so decoding a big message doesn't produce
+// garbage for every value. Everything allocated from the arena is
+// released at once with Reset and the memory is reused for the next
+// message. Values decoded before Reset must not be used after it.
+//
+// Values larger than the chunk size are allocated as usual.
+// Arena is not safe for concurrent use.
+type Arena struct {
+	chunkSize int
+
+	bufs [][]byte
+	buf  int // index of the current buffer in bufs
+	off  int
+
+	slabs map[reflect.Type]*slab
+	maps  map[reflect.Type]*mapPool
+}
+
+// NewArena returns an Arena allocating memory in chunks of chunkSize
+// bytes. Zero or negative chunkSize selects the default of 64KB.
+func NewArena(chunkSize int) *Arena {
+	if chunkSize <= 0 {
+		chunkSize = defaultArenaChunkSize
+	}
+	return &Arena{
+		chunkSize: chunkSize,
+		slabs:     make(map[reflect.Type]*slab),
+		maps:      make(map[reflect.Type]*mapPool),
+	}
+}
+
+// Reset releases everything allocated from the arena. Slices are
+// zeroed and maps are cleared so their memory can be reused.
+func (a *Arena) Reset() {
+	a.buf = 0
+	a.off = 0
+	for _, s := range a.slabs {
+		s.reset()
+	}
+	for _, p := range a.maps {
+		p.reset()
+	}
+}
+
+// bytes returns a slice of n bytes or nil if n is larger than the chunk.
+func (a *Arena) bytes(n int) []byte {
+	if n > a.chunkSize {
+		return nil
+	}
+	for {
+		if a.buf == len(a.bufs) {
+			a.bufs = append(a.bufs, make([]byte, a.chunkSize))
+		}
+		b := a.bufs[a.buf]
+		if a.off+n <= len(b) {
+			b = b[a.off : a.off+n : a.off+n]
+			a.off += n
+			return b
+		}
+		a.buf++
+		a.off = 0
+	}
+}
+
+func (a *Arena) string(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	s := a.bytes(len(b))
+	if s == nil {
+		return string(b)
+	}
+	copy(s, b)
+	return bytesToString(s)
+}
+
+// makeSlice returns a zeroed slice of type typ with n elements.
+func (a *Arena) makeSlice(typ reflect.Type, n int) (reflect.Value, bool) {
+	s, ok := a.slabs[typ]
+	if !ok {
+		s = newSlab(typ, a.chunkSize)
+		a.slabs[typ] = s
+	}
+	return s.alloc(n)
+}
+
+func (a *Arena) makeMap(typ reflect.Type) reflect.Value {
+	p, ok := a.maps[typ]
+	if !ok {
+		p = &mapPool{typ: typ}
+		a.maps[typ] = p
+	}
+	return p.get()
+}
+
+// slab allocates slices of one type from chunks of elements.
+type slab struct {
+	typ    reflect.Type
+	size   int // number of elements in a chunk
+	zero   reflect.Value
+	chunks []reflect.Value
+	chunk  int // index of the current chunk
+	off    int
+}
+
+func newSlab(typ reflect.Type, chunkSize int) *slab {
+	size := 0
+	if elemSize := int(typ.Elem().Size()); elemSize > 0 {
+		size = chunkSize / elemSize
+	}
+	return &slab{
+		typ:  typ,
+		size: size,
+	}
+}
+
+func (s *slab) alloc(n int) (reflect.Value, bool) {
+	if n > s.size {
+		return reflect.Value{}, false
+	}
+	for {
+		if s.chunk == len(s.chunks) {
+			s.chunks = append(s.chunks, reflect.MakeSlice(s.typ, s.size, s.size))
+		}
+		if s.off+n <= s.size {
+			v := s.chunks[s.chunk].Slice3(s.off, s.off+n, s.off+n)
+			s.off += n
+			return v, true
+		}
+		s.chunk++
+		s.off = 0
+	}
+}
+
+func (s *slab) reset() {
+	if len(s.chunks) == 0 {
+		return
+	}
+	if !s.zero.IsValid() {
+		s.zero = reflect.MakeSlice(s.typ, s.size, s.size)
+	}
+	for i := 0; i <= s.chunk && i < len(s.chunks); i++ {
+		reflect.Copy(s.chunks[i], s.zero)
+	}
+	s.chunk = 0
+	s.off = 0
+}
+
+// mapPool reuses maps of one type.
+type mapPool struct {
+	typ  reflect.Type
+	maps []reflect.Value
+	used int
+}
+
+func (p *mapPool) get() reflect.Value {
+	if p.used == len(p.maps) {
+		p.maps = append(p.maps, reflect.MakeMap(p.typ))
+	}
+	m := p.maps[p.used]
+	p.used++
+	return m
+}
+
+func (p *mapPool) reset() {
+	for _, m := range p.maps[:p.used] {
+		for _, k := range m.MapKeys() {
+			m.SetMapIndex(k, reflect.Value{})
+		}
+	}
+	p.used = 0
+}
+
+//------------------------------------------------------------------------------
+
+// SetArena causes the Decoder to allocate decoded strings, byte slices,
+// slices and maps from a. Nil a restores the regular allocation.
+func (d *Decoder) SetArena(a *Arena) {
+	d.arena = a
+}
+
+func (d *Decoder) makeMap(typ reflect.Type) reflect.Value {
+	if d.arena != nil {
+		return d.arena.makeMap(typ)
+	}
+	return reflect.MakeMap(typ)
+}
+
+// makeSlice allocates a slice from the arena if there is one.
+func (d *Decoder) makeSlice(typ reflect.Type, n int) (reflect.Value, bool) {
+	if d.arena == nil {
+		return reflect.Value{}, false
+	}
+	return d.arena.makeSlice(typ, n)
+}
+
+// makeBytes allocates a byte slice of length n from the arena
+// if there is one and b is too small.
+func (d *Decoder) makeBytes(b []byte, n int) []byte {
+	if d.arena == nil || cap(b) >= n {
+		return b
+	}
+	if ab := d.arena.bytes(n); ab != nil {
+		return ab[:0]
+	}
+	return b
+}
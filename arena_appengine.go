@@ -0,0 +1,10 @@
+//go:build appengine
+// +build appengine
+
+package msgpack
+
+// bytesToString copies b to a string because
+// App Engine doesn't allow package unsafe.
+func bytesToString(b []byte) string {
+	return string(b)
+}
@@ -0,0 +1,92 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type arenaItem struct {
+	Name  string
+	Data  []byte
+	Ints  []int
+	Attrs map[string]string
+	Extra map[string]interface{}
+}
+
+func TestArena(t *testing.T) {
+	in := []arenaItem{
+		{
+			Name:  "foo",
+			Data:  []byte{1, 2, 3},
+			Ints:  []int{1, 2},
+			Attrs: map[string]string{"a": "b"},
+			Extra: map[string]interface{}{"x": []interface{}{"y", int64(1)}},
+		},
+		{Name: "bar", Ints: []int{}},
+	}
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arena := msgpack.NewArena(256)
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetArena(arena)
+	for i := 0; i < 3; i++ {
+		var out []arenaItem
+		if err := dec.Reset(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		if err := dec.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, in) {
+			t.Fatalf("got %#v, wanted %#v", out, in)
+		}
+		arena.Reset()
+	}
+}
+
+func TestArenaAllocs(t *testing.T) {
+	in := make([]arenaItem, 100)
+	for i := range in {
+		in[i] = arenaItem{
+			Name: "some name",
+			Data: []byte("some data"),
+			Ints: []int{1, 2, 3},
+		}
+	}
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(b)
+	dec := msgpack.NewDecoder(r)
+	decode := func() {
+		r.Reset(b)
+		if err := dec.Reset(r); err != nil {
+			t.Fatal(err)
+		}
+		var out []arenaItem
+		if err := dec.Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain := testing.AllocsPerRun(10, decode)
+
+	arena := msgpack.NewArena(0)
+	dec.SetArena(arena)
+	withArena := testing.AllocsPerRun(10, func() {
+		decode()
+		arena.Reset()
+	})
+
+	if withArena >= plain/2 {
+		t.Fatalf("got %v allocs with arena, %v without", withArena, plain)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !appengine
+// +build !appengine
+
+package msgpack
+
+import (
+	"unsafe"
+)
+
+// bytesToString converts b to a string without copying.
+// b must not be modified afterwards.
+func bytesToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
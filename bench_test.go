@@ -266,6 +266,27 @@ func BenchmarkStructUnmarshal(b *testing.B) {
 	}
 }
 
+func BenchmarkStructSliceUnmarshal(b *testing.B) {
+	in := make([]*benchmarkStruct, 100)
+	for i := range in {
+		in[i] = structForBenchmark()
+	}
+	buf, err := msgpack.Marshal(in)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var out []*benchmarkStruct
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err = msgpack.Unmarshal(buf, &out)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkStructManual(b *testing.B) {
 	in := structForBenchmark2()
 	out := new(benchmarkStruct2)
@@ -0,0 +1,176 @@
+package msgpack
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// EncodeColumnar encodes a slice of structs (or pointers to structs) as
+// a map of field name to an array holding the field values of every
+// element. Batches of similar records are considerably smaller in this
+// form because field names are written once. Use DecodeColumnar to
+// decode the result.
+func (e *Encoder) EncodeColumnar(slice interface{}) error {
+	v := reflect.ValueOf(slice)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return e.EncodeNil()
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("msgpack: EncodeColumnar: got %s, wanted slice of structs", v.Type())
+	}
+	if v.Kind() == reflect.Slice && v.IsNil() {
+		return e.EncodeNil()
+	}
+
+	elemType, isPtr, err := columnarElem(v.Type())
+	if err != nil {
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if isPtr && v.Index(i).IsNil() {
+			return fmt.Errorf("msgpack: EncodeColumnar: nil element at index %d", i)
+		}
+	}
+
+	structFields := structs.Fields(elemType)
+	fields := structFields.List
+	if e.sortStructFields {
+		fields = structFields.Sorted
+	}
+
+	if err := e.EncodeMapLen(len(fields)); err != nil {
+		return err
+	}
+	n := v.Len()
+	for _, f := range fields {
+		if err := e.encodeFieldName(f); err != nil {
+			return err
+		}
+		if err := e.EncodeArrayLen(n); err != nil {
+			return err
+		}
+		e.pushPath(f.name)
+		for i := 0; i < n; i++ {
+			strct := v.Index(i)
+			if isPtr {
+				strct = strct.Elem()
+			}
+			if err := f.EncodeValue(e, strct); err != nil {
+				e.popPath()
+				return err
+			}
+		}
+		e.popPath()
+	}
+	return nil
+}
+
+// DecodeColumnar decodes data produced by EncodeColumnar into the slice
+// pointed to by v. Columns without a matching struct field are skipped
+// and fields without a column keep their zero values.
+func (d *Decoder) DecodeColumnar(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("msgpack: DecodeColumnar: got %T, wanted pointer to slice of structs", v)
+	}
+	slice := rv.Elem()
+
+	elemType, isPtr, err := columnarElem(slice.Type())
+	if err != nil {
+		return err
+	}
+
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		slice.Set(reflect.Zero(slice.Type()))
+		return nil
+	}
+
+	fields := structs.Fields(elemType)
+	keys := d.newKeySet(n)
+	rows := -1
+	for i := 0; i < n; i++ {
+		var f *field
+		if keys == nil {
+			f, err = d.decodeField(fields)
+		} else {
+			f, err = d.decodeFieldKey(fields, keys)
+		}
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			if err := d.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		l, err := d.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		if l == -1 {
+			l = 0
+		}
+		if rows == -1 {
+			rows = l
+			slice.Set(zeroSlice(slice, min(l, sliceElemsAllocLimit)))
+		} else if l != rows {
+			return fmt.Errorf(
+				"msgpack: DecodeColumnar: column %q has %d values, wanted %d", f.name, l, rows)
+		}
+
+		for j := 0; j < l; j++ {
+			if j >= slice.Len() {
+				slice.Set(growSliceValue(slice, l))
+			}
+			strct := slice.Index(j)
+			if isPtr {
+				if strct.IsNil() {
+					strct.Set(reflect.New(elemType))
+				}
+				strct = strct.Elem()
+			}
+			if err := f.DecodeValue(d, strct); err != nil {
+				return err
+			}
+		}
+	}
+	if rows == -1 {
+		slice.Set(zeroSlice(slice, 0))
+	}
+	return nil
+}
+
+func columnarElem(typ reflect.Type) (elemType reflect.Type, isPtr bool, err error) {
+	elemType = typ.Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+		isPtr = true
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil, false, fmt.Errorf("msgpack: columnar encoding requires slice of structs, got %s", typ)
+	}
+	return elemType, isPtr, nil
+}
+
+// zeroSlice returns slice of n zero elements reusing the capacity
+// of slice when possible.
+func zeroSlice(slice reflect.Value, n int) reflect.Value {
+	if slice.Cap() < n {
+		return reflect.MakeSlice(slice.Type(), n, n)
+	}
+	s := slice.Slice(0, n)
+	zero := reflect.Zero(slice.Type().Elem())
+	for i := 0; i < n; i++ {
+		s.Index(i).Set(zero)
+	}
+	return s
+}
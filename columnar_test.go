@@ -0,0 +1,85 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type columnarRow struct {
+	ID    int
+	Name  string
+	Score float64
+}
+
+func TestColumnar(t *testing.T) {
+	var in []columnarRow
+	for i := 0; i < 100; i++ {
+		in = append(in, columnarRow{ID: i, Name: "row", Score: float64(i) / 2})
+	}
+
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).EncodeColumnar(in); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= len(plain) {
+		t.Fatalf("got %d bytes, wanted less than %d", buf.Len(), len(plain))
+	}
+	b := buf.Bytes()
+
+	var out []columnarRow
+	if err := msgpack.NewDecoder(bytes.NewReader(b)).DecodeColumnar(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got %v, wanted %v", out, in)
+	}
+
+	// Missing columns keep zero values and unknown columns are skipped.
+	var ptrs []*struct {
+		ID    int
+		Extra string
+	}
+	if err := msgpack.NewDecoder(bytes.NewReader(b)).DecodeColumnar(&ptrs); err != nil {
+		t.Fatal(err)
+	}
+	if len(ptrs) != 100 || ptrs[42].ID != 42 || ptrs[42].Extra != "" {
+		t.Fatalf("got %v", ptrs)
+	}
+
+	var m map[string][]interface{}
+	if err := msgpack.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m["Name"]) != 100 {
+		t.Fatalf("got %v", m)
+	}
+}
+
+func TestColumnarMismatchedColumns(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"ID":   []int{1, 2},
+		"Name": []string{"a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []columnarRow
+	err = msgpack.NewDecoder(bytes.NewReader(b)).DecodeColumnar(&out)
+	if err == nil {
+		t.Fatal("got nil error, wanted column length mismatch")
+	}
+}
+
+func TestColumnarNotStructs(t *testing.T) {
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).EncodeColumnar([]int{1}); err == nil {
+		t.Fatal("got nil error")
+	}
+}
@@ -0,0 +1,160 @@
+package msgpack
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"sync"
+	"time"
+)
+
+// Conn sends and receives MessagePack values over a network connection.
+// Each value is encoded completely before it is written, so a value
+// that fails to encode never leaves partial data on the wire, and each
+// value is read completely before it is decoded, so a value that fails
+// to decode doesn't break the framing of the following values.
+//
+// Send and Recv are safe for concurrent use: concurrent calls of Send
+// (and of Recv) are serialized. An I/O error that may have left a partial
+// value on the connection is returned by all subsequent calls of the
+// same method.
+type Conn struct {
+	conn net.Conn
+
+	sendMu      sync.Mutex
+	sendTimeout time.Duration
+	buf         bytes.Buffer
+	enc         *Encoder
+	sendErr     error
+
+	recvMu      sync.Mutex
+	recvTimeout time.Duration
+	br          *bufio.Reader
+	rawDec      *Decoder
+	dec         *Decoder
+	raw         bytes.Reader
+	recvErr     error
+}
+
+// NewConn returns a Conn sending and receiving values over conn.
+func NewConn(conn net.Conn) *Conn {
+	c := &Conn{
+		conn: conn,
+		br:   bufio.NewReader(conn),
+	}
+	c.enc = NewEncoder(&c.buf)
+	c.rawDec = NewDecoder(c.br)
+	c.dec = NewDecoder(&c.raw)
+	return c
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// Encoder returns the Encoder used by Send to configure its options.
+// It must not be used concurrently with Send.
+func (c *Conn) Encoder() *Encoder {
+	return c.enc
+}
+
+// Decoder returns the Decoder used by Recv to configure its options.
+// It must not be used concurrently with Recv.
+func (c *Conn) Decoder() *Decoder {
+	return c.dec
+}
+
+// SetSendTimeout sets the time limit of each Send call.
+// Zero disables the limit. Send replaces write deadlines
+// set on the underlying connection.
+func (c *Conn) SetSendTimeout(d time.Duration) {
+	c.sendMu.Lock()
+	c.sendTimeout = d
+	c.sendMu.Unlock()
+}
+
+// SetRecvTimeout sets the time limit of each Recv call, including
+// waiting for the value to arrive. Zero disables the limit. Recv
+// replaces read deadlines set on the underlying connection.
+func (c *Conn) SetRecvTimeout(d time.Duration) {
+	c.recvMu.Lock()
+	c.recvTimeout = d
+	c.recvMu.Unlock()
+}
+
+// SetMaxMessageSize limits the size of values accepted by Recv.
+// See Decoder.SetMaxMessageSize.
+func (c *Conn) SetMaxMessageSize(n int) {
+	c.recvMu.Lock()
+	c.rawDec.SetMaxMessageSize(n)
+	c.recvMu.Unlock()
+}
+
+// Send encodes v and writes it to the connection.
+func (c *Conn) Send(v interface{}) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+
+	c.buf.Reset()
+	if err := c.enc.Encode(v); err != nil {
+		return err
+	}
+
+	if err := c.setDeadline(c.conn.SetWriteDeadline, c.sendTimeout); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(c.buf.Bytes()); err != nil {
+		c.sendErr = err
+		return err
+	}
+	return nil
+}
+
+// Recv reads the next value from the connection and decodes it into v.
+func (c *Conn) Recv(v interface{}) error {
+	c.recvMu.Lock()
+	defer c.recvMu.Unlock()
+
+	if c.recvErr != nil {
+		return c.recvErr
+	}
+
+	if err := c.setDeadline(c.conn.SetReadDeadline, c.recvTimeout); err != nil {
+		return err
+	}
+	// Errors while waiting for the value are not sticky
+	// because nothing has been consumed yet.
+	if _, err := c.br.Peek(1); err != nil {
+		return err
+	}
+
+	var raw RawMessage
+	if err := c.rawDec.Decode(&raw); err != nil {
+		c.recvErr = err
+		return err
+	}
+
+	c.raw.Reset(raw)
+	if err := c.dec.Reset(&c.raw); err != nil {
+		return err
+	}
+	return c.dec.Decode(v)
+}
+
+func (c *Conn) setDeadline(set func(time.Time) error, timeout time.Duration) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	return set(deadline)
+}
+
+// Close closes the underlying connection.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,94 @@
+package msgpack_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type connMsg struct {
+	Sender int
+	Seq    int
+	Body   string
+}
+
+func TestConnConcurrentSend(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client := msgpack.NewConn(c1)
+	server := msgpack.NewConn(c2)
+	defer client.Close()
+	defer server.Close()
+
+	const senders, msgs = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < msgs; j++ {
+				if err := client.Send(connMsg{Sender: i, Seq: j, Body: "hello"}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+
+	next := make([]int, senders)
+	for i := 0; i < senders*msgs; i++ {
+		var msg connMsg
+		if err := server.Recv(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Seq != next[msg.Sender] || msg.Body != "hello" {
+			t.Fatalf("got %+v, wanted seq %d", msg, next[msg.Sender])
+		}
+		next[msg.Sender]++
+	}
+	wg.Wait()
+}
+
+func TestConnErrors(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client := msgpack.NewConn(c1)
+	server := msgpack.NewConn(c2)
+	defer client.Close()
+	defer server.Close()
+
+	// Values that fail to encode are not sent.
+	if err := client.Send(make(chan int)); err == nil {
+		t.Fatal("got nil error")
+	}
+
+	// Timeout while waiting for a value keeps the connection usable.
+	server.SetRecvTimeout(10 * time.Millisecond)
+	var s string
+	err := server.Recv(&s)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("got %v, wanted timeout", err)
+	}
+	server.SetRecvTimeout(0)
+
+	go func() {
+		for _, v := range []interface{}{"foo", "bar"} {
+			if err := client.Send(v); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	// A value that doesn't fit the destination is consumed.
+	var n int
+	if err := server.Recv(&n); err == nil {
+		t.Fatal("got nil error")
+	}
+	if err := server.Recv(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s != "bar" {
+		t.Fatalf("got %q, wanted bar", s)
+	}
+}
@@ -0,0 +1,59 @@
+package msgpack
+
+import (
+	"context"
+	"reflect"
+)
+
+// WithContext sets the context that is available to custom encoders
+// and functions registered with RegisterContext.
+func (e *Encoder) WithContext(ctx context.Context) *Encoder {
+	e.ctx = ctx
+	return e
+}
+
+// Context returns the Encoder context or context.Background.
+func (e *Encoder) Context() context.Context {
+	if e.ctx != nil {
+		return e.ctx
+	}
+	return context.Background()
+}
+
+// WithContext sets the context that is available to custom decoders
+// and functions registered with RegisterContext.
+func (d *Decoder) WithContext(ctx context.Context) *Decoder {
+	d.ctx = ctx
+	return d
+}
+
+// Context returns the Decoder context or context.Background.
+func (d *Decoder) Context() context.Context {
+	if d.ctx != nil {
+		return d.ctx
+	}
+	return context.Background()
+}
+
+// RegisterContext is like Register, but registered functions receive
+// the context set with Encoder.WithContext and Decoder.WithContext,
+// e.g. to carry request-scoped data like tenant keys or schema versions.
+func RegisterContext(
+	value interface{},
+	enc func(context.Context, *Encoder, reflect.Value) error,
+	dec func(context.Context, *Decoder, reflect.Value) error,
+) {
+	var encFn encoderFunc
+	if enc != nil {
+		encFn = func(e *Encoder, v reflect.Value) error {
+			return enc(e.Context(), e, v)
+		}
+	}
+	var decFn decoderFunc
+	if dec != nil {
+		decFn = func(d *Decoder, v reflect.Value) error {
+			return dec(d.Context(), d, v)
+		}
+	}
+	Register(value, encFn, decFn)
+}
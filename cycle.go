@@ -0,0 +1,65 @@
+package msgpack
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type visitKey struct {
+	ptr uintptr
+	// len distinguishes slices sharing the backing array.
+	len int
+	typ reflect.Type
+}
+
+func newVisitKey(v reflect.Value) visitKey {
+	key := visitKey{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		key.len = v.Len()
+	}
+	return key
+}
+
+// DetectCycles causes the Encoder to track pointers, maps and slices being encoded
+// and return an error when a value references itself instead of recursing
+// until the stack overflows.
+func (e *Encoder) DetectCycles(v bool) *Encoder {
+	e.detectCycles = v
+	return e
+}
+
+// enter marks pointer, map or slice v as being encoded.
+func (e *Encoder) enter(v reflect.Value) error {
+	key := newVisitKey(v)
+	if _, ok := e.visiting[key]; ok {
+		path := strings.Join(e.path, ".")
+		if path == "" {
+			return fmt.Errorf("msgpack: cycle detected at top-level value (%s)", v.Type())
+		}
+		return fmt.Errorf("msgpack: cycle detected at field %q (%s)", path, v.Type())
+	}
+	if e.visiting == nil {
+		e.visiting = make(map[visitKey]struct{})
+	}
+	e.visiting[key] = struct{}{}
+	return nil
+}
+
+func (e *Encoder) leave(v reflect.Value) {
+	delete(e.visiting, newVisitKey(v))
+}
+
+// pushPath and popPath maintain path to the value being encoded
+// that is reported in cycle errors.
+func (e *Encoder) pushPath(name string) {
+	if e.detectCycles {
+		e.path = append(e.path, name)
+	}
+}
+
+func (e *Encoder) popPath() {
+	if e.detectCycles {
+		e.path = e.path[:len(e.path)-1]
+	}
+}
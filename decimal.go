@@ -0,0 +1,242 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+var decimalExtId int8 = -126
+
+// Decimal is a fixed-point decimal number with the value Coef * 10^Exp.
+// It is encoded as ext with 4 bytes of big-endian exponent followed
+// by big-endian two's complement coefficient.
+type Decimal struct {
+	Coef *big.Int // nil means 0
+	Exp  int32
+}
+
+// DecimalAdapter converts values of a third-party decimal type,
+// e.g. shopspring/decimal or apd, from and to Decimal.
+type DecimalAdapter interface {
+	ToDecimal(v interface{}) (Decimal, error)
+	FromDecimal(dec Decimal) (interface{}, error)
+}
+
+func init() {
+	decimalType := reflect.TypeOf((*Decimal)(nil)).Elem()
+	registerBuiltin(decimalType, encodeDecimalValue, decodeDecimalValue)
+}
+
+// RegisterDecimal registers a decimal type, identified by a value for that
+// type, to be encoded as Decimal using the adapter.
+func RegisterDecimal(value interface{}, adapter DecimalAdapter) {
+	typ := reflect.TypeOf(value)
+	enc := func(e *Encoder, v reflect.Value) error {
+		dec, err := adapter.ToDecimal(v.Interface())
+		if err != nil {
+			return err
+		}
+		return e.EncodeDecimal(dec)
+	}
+	dec := func(d *Decoder, v reflect.Value) error {
+		dec, err := d.DecodeDecimal()
+		if err != nil {
+			return err
+		}
+		x, err := adapter.FromDecimal(dec)
+		if err != nil {
+			return err
+		}
+		xv := reflect.ValueOf(x)
+		if !xv.IsValid() || xv.Type() != typ {
+			return fmt.Errorf("msgpack: DecimalAdapter returned %T, wanted %s", x, typ)
+		}
+		v.Set(xv)
+		return nil
+	}
+	Register(value, enc, dec)
+}
+
+// ParseDecimal parses a decimal number like -123.45 or 1.2e-3.
+func ParseDecimal(s string) (Decimal, error) {
+	var exp int64
+	digits := s
+	if i := strings.IndexAny(digits, "eE"); i >= 0 {
+		var err error
+		exp, err = strconv.ParseInt(digits[i+1:], 10, 32)
+		if err != nil {
+			return Decimal{}, fmt.Errorf("msgpack: invalid decimal: %q", s)
+		}
+		digits = digits[:i]
+	}
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		exp -= int64(len(digits) - i - 1)
+		digits = digits[:i] + digits[i+1:]
+	}
+	if exp < -1<<31 || exp > 1<<31-1 {
+		return Decimal{}, fmt.Errorf("msgpack: invalid decimal: %q", s)
+	}
+
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("msgpack: invalid decimal: %q", s)
+	}
+	return Decimal{Coef: coef, Exp: int32(exp)}, nil
+}
+
+func (x Decimal) coef() *big.Int {
+	if x.Coef == nil {
+		return new(big.Int)
+	}
+	return x.Coef
+}
+
+// String returns the decimal without exponent, e.g. 123.45.
+func (x Decimal) String() string {
+	coef := x.coef()
+	s := new(big.Int).Abs(coef).String()
+	if x.Exp > 0 {
+		s += strings.Repeat("0", int(x.Exp))
+	} else if x.Exp < 0 {
+		n := int(-x.Exp)
+		if len(s) <= n {
+			s = strings.Repeat("0", n-len(s)+1) + s
+		}
+		s = s[:len(s)-n] + "." + s[len(s)-n:]
+	}
+	if coef.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Cmp compares the values of x and y ignoring their exponents,
+// e.g. 1.0 equals 1.
+func (x Decimal) Cmp(y Decimal) int {
+	a, b := x.coef(), y.coef()
+	if x.Exp > y.Exp {
+		a = scaleCoef(a, int64(x.Exp)-int64(y.Exp))
+	} else if y.Exp > x.Exp {
+		b = scaleCoef(b, int64(y.Exp)-int64(x.Exp))
+	}
+	return a.Cmp(b)
+}
+
+func scaleCoef(coef *big.Int, n int64) *big.Int {
+	m := new(big.Int).Exp(big.NewInt(10), big.NewInt(n), nil)
+	return m.Mul(m, coef)
+}
+
+func (e *Encoder) EncodeDecimal(x Decimal) error {
+	return e.encodeExt(decimalExtId, func(e *Encoder) error {
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(x.Exp))
+		if err := e.write(b[:]); err != nil {
+			return err
+		}
+		return e.write(bigIntBytes(x.coef()))
+	})
+}
+
+// DecodeDecimal decodes Decimal. For compatibility strings accepted
+// by ParseDecimal and integers are supported as well.
+func (d *Decoder) DecodeDecimal() (Decimal, error) {
+	c, err := d.readCode()
+	if err != nil {
+		return Decimal{}, err
+	}
+
+	switch {
+	case c == codes.Nil:
+		return Decimal{}, nil
+	case codes.IsExt(c):
+		n, err := d.parseExtLen(c)
+		if err != nil {
+			return Decimal{}, err
+		}
+		id, err := d.readCode()
+		if err != nil {
+			return Decimal{}, err
+		}
+		if int8(id) != decimalExtId {
+			return Decimal{}, fmt.Errorf("msgpack: invalid ext id=%d decoding decimal", int8(id))
+		}
+		return d.decimal(n)
+	case isStringCode(c):
+		s, err := d.string(c)
+		if err != nil {
+			return Decimal{}, err
+		}
+		return ParseDecimal(s)
+	case c == codes.Uint64:
+		n, err := d.uint(c)
+		if err != nil {
+			return Decimal{}, err
+		}
+		return Decimal{Coef: new(big.Int).SetUint64(n)}, nil
+	default:
+		n, err := d.int(c)
+		if err != nil {
+			return Decimal{}, err
+		}
+		return Decimal{Coef: big.NewInt(n)}, nil
+	}
+}
+
+func (d *Decoder) decimal(extLen int) (Decimal, error) {
+	if extLen < 4 {
+		return Decimal{}, fmt.Errorf("msgpack: invalid ext len=%d decoding decimal", extLen)
+	}
+	b, err := d.readN(extLen)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return Decimal{
+		Coef: bigIntFromBytes(b[4:]),
+		Exp:  int32(binary.BigEndian.Uint32(b)),
+	}, nil
+}
+
+// bigIntBytes returns x as big-endian two's complement.
+func bigIntBytes(x *big.Int) []byte {
+	switch x.Sign() {
+	case 0:
+		return nil
+	case 1:
+		b := x.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	n := x.BitLen()/8 + 1
+	y := new(big.Int).Lsh(big.NewInt(1), uint(n*8))
+	return y.Add(y, x).Bytes()
+}
+
+func bigIntFromBytes(b []byte) *big.Int {
+	x := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		x.Sub(x, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return x
+}
+
+func encodeDecimalValue(e *Encoder, v reflect.Value) error {
+	return e.EncodeDecimal(v.Interface().(Decimal))
+}
+
+func decodeDecimalValue(d *Decoder, v reflect.Value) error {
+	x, err := d.DecodeDecimal()
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(x))
+	return nil
+}
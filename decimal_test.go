@@ -0,0 +1,123 @@
+package msgpack_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// cents is a stand-in for third-party decimal types.
+type cents int64
+
+type centsAdapter struct{}
+
+func (centsAdapter) ToDecimal(v interface{}) (msgpack.Decimal, error) {
+	return msgpack.Decimal{Coef: big.NewInt(int64(v.(cents))), Exp: -2}, nil
+}
+
+func (centsAdapter) FromDecimal(dec msgpack.Decimal) (interface{}, error) {
+	coef := new(big.Int).Set(dec.Coef)
+	for exp := dec.Exp; exp < -2; exp++ {
+		coef.Quo(coef, big.NewInt(10))
+	}
+	for exp := dec.Exp; exp > -2; exp-- {
+		coef.Mul(coef, big.NewInt(10))
+	}
+	return cents(coef.Int64()), nil
+}
+
+func init() {
+	msgpack.RegisterDecimal(cents(0), centsAdapter{})
+}
+
+func TestDecimal(t *testing.T) {
+	for _, s := range []string{
+		"0",
+		"123.45",
+		"-123.45",
+		"-128",
+		"0.001",
+		"12345678901234567890123456789.123456789",
+		"-170141183460469231731687303715884105728",
+	} {
+		in, err := msgpack.ParseDecimal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.String() != s {
+			t.Fatalf("got %s, wanted %s", in, s)
+		}
+
+		b, err := msgpack.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out msgpack.Decimal
+		if err := msgpack.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != s {
+			t.Fatalf("got %s, wanted %s", out, s)
+		}
+
+		var iface interface{}
+		if err := msgpack.Unmarshal(b, &iface); err != nil {
+			t.Fatal(err)
+		}
+		if dec, ok := iface.(msgpack.Decimal); !ok || dec.Cmp(in) != 0 {
+			t.Fatalf("got %#v, wanted %s", iface, s)
+		}
+	}
+}
+
+func TestDecimalCompat(t *testing.T) {
+	for _, test := range []struct {
+		in     interface{}
+		wanted string
+	}{
+		{"1.5e3", "1500"},
+		{int64(-42), "-42"},
+		{uint64(1<<63 + 1), "9223372036854775809"},
+	} {
+		b, err := msgpack.Marshal(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out msgpack.Decimal
+		if err := msgpack.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.wanted {
+			t.Fatalf("got %s, wanted %s", out, test.wanted)
+		}
+	}
+}
+
+func TestRegisterDecimal(t *testing.T) {
+	b, err := msgpack.Marshal(cents(12345))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dec msgpack.Decimal
+	if err := msgpack.Unmarshal(b, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec.String() != "123.45" {
+		t.Fatalf("got %s, wanted 123.45", dec)
+	}
+
+	b, err = msgpack.Marshal(msgpack.Decimal{Coef: big.NewInt(5), Exp: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out cents
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != 50 {
+		t.Fatalf("got %d, wanted 50", out)
+	}
+}
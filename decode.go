@@ -3,6 +3,7 @@ package msgpack
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -32,25 +33,65 @@ func makeBuffer() []byte {
 }
 
 // Unmarshal decodes the MessagePack-encoded data and stores the result
-// in the value pointed to by v.
+// in the value pointed to by v. It returns an error if data has bytes
+// left after decoding the values.
 func Unmarshal(data []byte, v ...interface{}) error {
-	return NewDecoder(bytes.NewReader(data)).Decode(v...)
+	n, err := UnmarshalPrefix(data, v...)
+	if err != nil {
+		return err
+	}
+	if n < len(data) {
+		return fmt.Errorf("msgpack: %d bytes remain after the value", len(data)-n)
+	}
+	return nil
+}
+
+// UnmarshalPrefix is like Unmarshal, but it allows data to have bytes
+// left after the values and returns the number of bytes consumed.
+func UnmarshalPrefix(data []byte, v ...interface{}) (int, error) {
+	r := bytes.NewReader(data)
+	err := NewDecoder(r).Decode(v...)
+	return len(data) - r.Len(), err
 }
 
 type Decoder struct {
+	src io.Reader // reader passed by the user
 	r   bufReader
 	buf []byte
+	ctx context.Context
 
 	extLen int
 	rec    []byte // accumulates read data if not nil
 
 	decodeMapFunc func(*Decoder) (interface{}, error)
+
+	caseInsensitiveFields bool
+	tolerantTime          bool
+	validateUTF8          bool
+	rejectNonFiniteFloats bool
+	disallowDuplicateKeys bool
+	strictStructArrays    bool
+
+	sharedRefs bool
+	refs       []interface{}
+
+	keys []string // key dictionary
+
+	maxSize int64
+	size    int64 // bytes consumed decoding the current value
+	depth   int   // nesting of Decode calls
+
+	stats *statsCollector
+	arena *Arena
+
+	iterErr error
 }
 
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
 		decodeMapFunc: decodeMap,
 
+		src: r,
 		r:   newBufReader(r),
 		buf: makeBuffer(),
 	}
@@ -60,13 +101,103 @@ func (d *Decoder) SetDecodeMapFunc(fn func(*Decoder) (interface{}, error)) {
 	d.decodeMapFunc = fn
 }
 
+// CaseInsensitiveFields causes the Decoder to match map keys to struct
+// fields ignoring case and underscores when there is no exact match,
+// e.g. "user_id" and "userId" are decoded into the field UserID.
+func (d *Decoder) CaseInsensitiveFields(v bool) *Decoder {
+	d.caseInsensitiveFields = v
+	return d
+}
+
+// TolerantTime causes the Decoder to accept Unix timestamps encoded
+// as integer or float seconds and nil when decoding time.Time, in addition
+// to the ext formats, the legacy [sec, nsec] array and RFC3339 strings
+// that are always accepted.
+func (d *Decoder) TolerantTime(v bool) *Decoder {
+	d.tolerantTime = v
+	return d
+}
+
+// ValidateUTF8 causes the Decoder to return an error when a string
+// being decoded is not valid UTF-8.
+func (d *Decoder) ValidateUTF8(v bool) *Decoder {
+	d.validateUTF8 = v
+	return d
+}
+
+// RejectNonFiniteFloats causes the Decoder to return an error
+// when it decodes NaN or ±Inf.
+func (d *Decoder) RejectNonFiniteFloats(v bool) *Decoder {
+	d.rejectNonFiniteFloats = v
+	return d
+}
+
+// DisallowDuplicateKeys causes the Decoder to return an error when
+// a map contains duplicate keys instead of using the last value.
+// When decoding into structs keys matching the same field are
+// considered duplicates.
+func (d *Decoder) DisallowDuplicateKeys(v bool) *Decoder {
+	d.disallowDuplicateKeys = v
+	return d
+}
+
+// StrictStructArrays causes the Decoder to return an error when a struct
+// is decoded from an array with a different number of elements than
+// the struct has fields. By default missing trailing fields are left
+// untouched and extra trailing elements are skipped, so structs encoded
+// as arrays can gain or lose trailing fields between versions.
+func (d *Decoder) StrictStructArrays(v bool) *Decoder {
+	d.strictStructArrays = v
+	return d
+}
+
 func (d *Decoder) Reset(r io.Reader) error {
+	d.src = r
 	d.r = newBufReader(r)
+	d.size = 0
+	d.wrapReader()
+	if d.sharedRefs {
+		d.ensurePeeker()
+	}
 	return nil
 }
 
+// Buffered returns a reader of the data read ahead by the Decoder
+// but not decoded yet. The reader is valid until the next call of
+// the Decoder. Data is read ahead only if the reader passed to the
+// Decoder does not implement io.ByteScanner.
+func (d *Decoder) Buffered() io.Reader {
+	r := d.r
+	if l, ok := r.(*sizeLimiter); ok {
+		r = l.r
+	}
+	br, ok := r.(*bufio.Reader)
+	if !ok || io.Reader(br) == d.src {
+		return bytes.NewReader(nil)
+	}
+	b, _ := br.Peek(br.Buffered())
+	return bytes.NewReader(b)
+}
+
 func (d *Decoder) Decode(v ...interface{}) error {
+	// Values decoded by nested calls, e.g. from CustomDecoder,
+	// are a part of the outer value and share its size limit.
+	d.depth++
+	defer func() { d.depth-- }()
+
 	for _, vv := range v {
+		if d.depth == 1 {
+			d.size = 0
+		}
+		if d.stats != nil {
+			start := d.stats.begin()
+			err := d.decode(vv)
+			d.stats.end(start, decodedType(vv), err)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		if err := d.decode(vv); err != nil {
 			return err
 		}
@@ -76,97 +207,98 @@ func (d *Decoder) Decode(v ...interface{}) error {
 
 func (d *Decoder) decode(dst interface{}) error {
 	var err error
-	switch v := dst.(type) {
-	case *string:
-		if v != nil {
-			*v, err = d.DecodeString()
-			return err
-		}
-	case *[]byte:
-		if v != nil {
-			return d.decodeBytesPtr(v)
-		}
-	case *int:
-		if v != nil {
-			*v, err = d.DecodeInt()
-			return err
-		}
-	case *int8:
-		if v != nil {
-			*v, err = d.DecodeInt8()
-			return err
-		}
-	case *int16:
-		if v != nil {
-			*v, err = d.DecodeInt16()
-			return err
-		}
-	case *int32:
-		if v != nil {
-			*v, err = d.DecodeInt32()
-			return err
-		}
-	case *int64:
-		if v != nil {
-			*v, err = d.DecodeInt64()
-			return err
-		}
-	case *uint:
-		if v != nil {
-			*v, err = d.DecodeUint()
-			return err
-		}
-	case *uint8:
-		if v != nil {
-			*v, err = d.DecodeUint8()
-			return err
-		}
-	case *uint16:
-		if v != nil {
-			*v, err = d.DecodeUint16()
-			return err
-		}
-	case *uint32:
-		if v != nil {
-			*v, err = d.DecodeUint32()
-			return err
-		}
-	case *uint64:
-		if v != nil {
-			*v, err = d.DecodeUint64()
-			return err
-		}
-	case *bool:
-		if v != nil {
-			*v, err = d.DecodeBool()
-			return err
-		}
-	case *float32:
-		if v != nil {
-			*v, err = d.DecodeFloat32()
-			return err
-		}
-	case *float64:
-		if v != nil {
-			*v, err = d.DecodeFloat64()
-			return err
-		}
-	case *[]string:
-		return d.decodeStringSlicePtr(v)
-	case *map[string]string:
-		return d.decodeMapStringStringPtr(v)
-	case *map[string]interface{}:
-		return d.decodeMapStringInterfacePtr(v)
-	case *time.Duration:
-		if v != nil {
-			vv, err := d.DecodeInt64()
-			*v = time.Duration(vv)
-			return err
-		}
-	case *time.Time:
-		if v != nil {
-			*v, err = d.DecodeTime()
-			return err
+	if useFastPath() && !d.sharedRefs {
+		switch v := dst.(type) {
+		case *string:
+			if v != nil {
+				*v, err = d.DecodeString()
+				return err
+			}
+		case *[]byte:
+			if v != nil {
+				return d.decodeBytesPtr(v)
+			}
+		case *int:
+			if v != nil {
+				*v, err = d.DecodeInt()
+				return err
+			}
+		case *int8:
+			if v != nil {
+				*v, err = d.DecodeInt8()
+				return err
+			}
+		case *int16:
+			if v != nil {
+				*v, err = d.DecodeInt16()
+				return err
+			}
+		case *int32:
+			if v != nil {
+				*v, err = d.DecodeInt32()
+				return err
+			}
+		case *int64:
+			if v != nil {
+				*v, err = d.DecodeInt64()
+				return err
+			}
+		case *uint:
+			if v != nil {
+				*v, err = d.DecodeUint()
+				return err
+			}
+		case *uint8:
+			if v != nil {
+				*v, err = d.DecodeUint8()
+				return err
+			}
+		case *uint16:
+			if v != nil {
+				*v, err = d.DecodeUint16()
+				return err
+			}
+		case *uint32:
+			if v != nil {
+				*v, err = d.DecodeUint32()
+				return err
+			}
+		case *uint64:
+			if v != nil {
+				*v, err = d.DecodeUint64()
+				return err
+			}
+		case *bool:
+			if v != nil {
+				*v, err = d.DecodeBool()
+				return err
+			}
+		case *float32:
+			if v != nil {
+				*v, err = d.DecodeFloat32()
+				return err
+			}
+		case *float64:
+			if v != nil {
+				*v, err = d.DecodeFloat64()
+				return err
+			}
+		case *[]string:
+			return d.decodeStringSlicePtr(v)
+		case *map[string]string:
+			return d.decodeMapStringStringPtr(v)
+		case *map[string]interface{}:
+			return d.decodeMapStringInterfacePtr(v)
+		case *time.Duration:
+			if v != nil {
+				*v, err = d.DecodeDuration()
+				return err
+			}
+		case *time.Time:
+			if v != nil {
+				*v, err = d.DecodeTime()
+				return err
+			}
 		}
 	}
 
@@ -177,6 +309,15 @@ func (d *Decoder) decode(dst interface{}) error {
 	if v.Kind() != reflect.Ptr {
 		return fmt.Errorf("msgpack: Decode(nonsettable %T)", dst)
 	}
+	// Pointer dst is the pointer that was encoded, unless it points to
+	// another pointer or interface that are decoded as usual.
+	if d.sharedRefs && !v.IsNil() {
+		if kind := v.Type().Elem().Kind(); kind != reflect.Ptr && kind != reflect.Interface {
+			if done, err := d.decodeSharedRef(v, getDecoder(v.Type().Elem())); done || err != nil {
+				return err
+			}
+		}
+	}
 	v = v.Elem()
 	if !v.IsValid() {
 		return fmt.Errorf("msgpack: Decode(nonsettable %T)", dst)
@@ -258,6 +399,10 @@ func (d *Decoder) interfaceValue(v reflect.Value) error {
 //   - []byte,
 //   - slices of any of the above,
 //   - maps of any of the above.
+//
+// Maps are decoded as map[string]interface{} unless they have keys
+// that are not strings, in which case map[interface{}]interface{}
+// is used.
 func (d *Decoder) DecodeInterface() (interface{}, error) {
 	c, err := d.readCode()
 	if err != nil {
@@ -423,6 +568,22 @@ func (d *Decoder) Skip() error {
 	return fmt.Errorf("msgpack: unknown code %x", c)
 }
 
+// readRaw reads the next value and returns its undecoded bytes.
+func (d *Decoder) readRaw() ([]byte, error) {
+	rec := d.rec
+	d.rec = makeBuffer()
+	err := d.Skip()
+	b := d.rec
+	d.rec = rec
+	if err != nil {
+		return nil, err
+	}
+	if d.rec != nil {
+		d.rec = append(d.rec, b...)
+	}
+	return b, nil
+}
+
 // PeekCode returns the next MessagePack code without advancing the reader.
 // Subpackage msgpack/codes contains list of available codes.
 func (d *Decoder) PeekCode() (codes.Code, error) {
@@ -460,6 +621,22 @@ func (d *Decoder) readFull(b []byte) error {
 	return nil
 }
 
+// copyN copies n bytes to w without buffering them in the Decoder.
+func (d *Decoder) copyN(w io.Writer, n int64) (int64, error) {
+	if d.rec == nil {
+		return io.CopyN(w, d.r, n)
+	}
+	return io.CopyN(w, io.TeeReader(d.r, (*recorder)(d)), n)
+}
+
+// recorder appends written bytes to the recorded value.
+type recorder Decoder
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.rec = append(r.rec, b...)
+	return len(b), nil
+}
+
 func (d *Decoder) readN(n int) ([]byte, error) {
 	buf, err := readN(d.r, d.buf, n)
 	if err != nil {
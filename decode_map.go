@@ -3,6 +3,7 @@ package msgpack
 import (
 	"fmt"
 	"reflect"
+	"unicode/utf8"
 
 	"github.com/vmihailenco/msgpack/codes"
 )
@@ -28,25 +29,35 @@ func decodeMapValue(d *Decoder, v reflect.Value) error {
 	}
 
 	if v.IsNil() {
-		v.Set(reflect.MakeMap(typ))
+		v.Set(d.makeMap(typ))
 	}
 	keyType := typ.Key()
 	valueType := typ.Elem()
+	keys := d.newKeySet(n)
+	var missing []string
 
 	for i := 0; i < n; i++ {
 		mk := reflect.New(keyType).Elem()
 		if err := d.DecodeValue(mk); err != nil {
 			return err
 		}
+		if err := keys.add(mk.Interface()); err != nil {
+			return err
+		}
 
 		mv := reflect.New(valueType).Elem()
 		if err := d.DecodeValue(mv); err != nil {
-			return err
+			if !collectRequired(&missing, fmt.Sprint(mk.Interface()), err) {
+				return err
+			}
 		}
 
 		v.SetMapIndex(mk, mv)
 	}
 
+	if len(missing) > 0 {
+		return &RequiredFieldsError{Paths: missing}
+	}
 	return nil
 }
 
@@ -59,21 +70,88 @@ func decodeMap(d *Decoder) (interface{}, error) {
 		return nil, nil
 	}
 
-	m := make(map[string]interface{}, min(n, mapElemsAllocLimit))
+	var m map[string]interface{}
+	if d.arena != nil {
+		m = d.arena.makeMap(mapStringInterfaceType).Interface().(map[string]interface{})
+	} else {
+		m = make(map[string]interface{}, min(n, mapElemsAllocLimit))
+	}
+	keys := d.newKeySet(n)
+	var im map[interface{}]interface{}
 	for i := 0; i < n; i++ {
-		mk, err := d.DecodeString()
+		c, err := d.PeekCode()
 		if err != nil {
 			return nil, err
 		}
+		if im == nil && (isStringCode(c) || codes.IsExt(c)) {
+			mk, err := d.DecodeString()
+			if err != nil {
+				return nil, err
+			}
+			if err := keys.add(mk); err != nil {
+				return nil, err
+			}
+			mv, err := d.DecodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			m[mk] = mv
+			continue
+		}
+
+		// Maps with other keys, e.g. integer keys written by
+		// Encoder.UseIntKeys, are decoded as map[interface{}]interface{}.
+		if im == nil {
+			im = make(map[interface{}]interface{}, min(n, mapElemsAllocLimit))
+			for k, v := range m {
+				im[k] = v
+			}
+		}
+		mk, err := d.DecodeInterface()
+		if err != nil {
+			return nil, err
+		}
+		if mk != nil && !reflect.TypeOf(mk).Comparable() {
+			return nil, fmt.Errorf("msgpack: unsupported map key type %T", mk)
+		}
+		if err := keys.add(mk); err != nil {
+			return nil, err
+		}
 		mv, err := d.DecodeInterface()
 		if err != nil {
 			return nil, err
 		}
-		m[mk] = mv
+		im[mk] = mv
+	}
+	if im != nil {
+		return im, nil
 	}
 	return m, nil
 }
 
+// keySet tracks decoded map keys when duplicate keys are disallowed.
+type keySet map[interface{}]struct{}
+
+func (d *Decoder) newKeySet(n int) keySet {
+	if !d.disallowDuplicateKeys {
+		return nil
+	}
+	return make(keySet, min(n, mapElemsAllocLimit))
+}
+
+func (s keySet) add(key interface{}) error {
+	if s == nil {
+		return nil
+	}
+	if _, ok := s[key]; ok {
+		return fmt.Errorf("msgpack: duplicate map key: %v", key)
+	}
+	s[key] = struct{}{}
+	return nil
+}
+
+// DecodeMapLen decodes the header of a map and returns the number of
+// key and value pairs that follow it, or -1 if the value is nil.
 func (d *Decoder) DecodeMapLen() (int, error) {
 	c, err := d.readCode()
 	if err != nil {
@@ -103,11 +181,17 @@ func (d *Decoder) mapLen(c codes.Code) (int, error) {
 	}
 	if c == codes.Map16 {
 		n, err := d.uint16()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkLen(int(n), 2)
 	}
 	if c == codes.Map32 {
 		n, err := d.uint32()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkLen(int(n), 2)
 	}
 	return 0, fmt.Errorf("msgpack: invalid code=%x decoding map length", c)
 }
@@ -129,15 +213,23 @@ func (d *Decoder) decodeMapStringStringPtr(ptr *map[string]string) error {
 
 	m := *ptr
 	if m == nil {
-		*ptr = make(map[string]string, min(n, mapElemsAllocLimit))
+		if d.arena != nil {
+			*ptr = d.arena.makeMap(mapStringStringType).Interface().(map[string]string)
+		} else {
+			*ptr = make(map[string]string, min(n, mapElemsAllocLimit))
+		}
 		m = *ptr
 	}
 
+	keys := d.newKeySet(n)
 	for i := 0; i < n; i++ {
 		mk, err := d.DecodeString()
 		if err != nil {
 			return err
 		}
+		if err := keys.add(mk); err != nil {
+			return err
+		}
 		mv, err := d.DecodeString()
 		if err != nil {
 			return err
@@ -165,15 +257,23 @@ func (d *Decoder) decodeMapStringInterfacePtr(ptr *map[string]interface{}) error
 
 	m := *ptr
 	if m == nil {
-		*ptr = make(map[string]interface{}, min(n, mapElemsAllocLimit))
+		if d.arena != nil {
+			*ptr = d.arena.makeMap(mapStringInterfaceType).Interface().(map[string]interface{})
+		} else {
+			*ptr = make(map[string]interface{}, min(n, mapElemsAllocLimit))
+		}
 		m = *ptr
 	}
 
+	keys := d.newKeySet(n)
 	for i := 0; i < n; i++ {
 		mk, err := d.DecodeString()
 		if err != nil {
 			return err
 		}
+		if err := keys.add(mk); err != nil {
+			return err
+		}
 		mv, err := d.DecodeInterface()
 		if err != nil {
 			return err
@@ -184,6 +284,22 @@ func (d *Decoder) decodeMapStringInterfacePtr(ptr *map[string]interface{}) error
 	return nil
 }
 
+// DecodeMapFunc decodes the map length and calls fn for each entry.
+// fn must decode exactly two values: the key and the value. Nil is decoded
+// as an empty map. The first error returned by fn is returned.
+func (d *Decoder) DecodeMapFunc(fn func(d *Decoder) error) error {
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *Decoder) DecodeMap() (interface{}, error) {
 	return d.decodeMapFunc(d)
 }
@@ -204,6 +320,83 @@ func (d *Decoder) skipMap(c codes.Code) error {
 	return nil
 }
 
+// decodeField decodes a map key, either a name or an id, and returns
+// the struct field it refers to or nil. Unlike DecodeString it doesn't allocate the key.
+func (d *Decoder) decodeField(fs *fields) (*field, error) {
+	c, err := d.readCode()
+	if err != nil {
+		return nil, err
+	}
+	if isIntCode(c) {
+		id, err := d.int(c)
+		if err != nil {
+			return nil, err
+		}
+		return fs.IDs[id], nil
+	}
+	if codes.IsExt(c) {
+		name, err := d.string(c)
+		if err != nil {
+			return nil, err
+		}
+		return fs.Lookup(name, d.caseInsensitiveFields), nil
+	}
+
+	n, err := d.bytesLen(c)
+	if err != nil {
+		return nil, err
+	}
+	if n == -1 {
+		n = 0
+	}
+	b, err := d.readN(n)
+	if err != nil {
+		return nil, err
+	}
+	if d.validateUTF8 && !utf8.Valid(b) {
+		return nil, ErrInvalidUTF8
+	}
+	if f, ok := fs.Table[string(b)]; ok {
+		return f, nil
+	}
+	if d.caseInsensitiveFields {
+		return fs.Fold[foldName(string(b))], nil
+	}
+	return nil, nil
+}
+
+// decodeFieldKey is like decodeField, but also adds the key to keys
+// to detect duplicates.
+func (d *Decoder) decodeFieldKey(fs *fields, keys keySet) (*field, error) {
+	c, err := d.readCode()
+	if err != nil {
+		return nil, err
+	}
+
+	var f *field
+	var key interface{}
+	if isIntCode(c) {
+		id, err := d.int(c)
+		if err != nil {
+			return nil, err
+		}
+		f = fs.IDs[id]
+		key = id
+	} else {
+		name, err := d.string(c)
+		if err != nil {
+			return nil, err
+		}
+		f = fs.Lookup(name, d.caseInsensitiveFields)
+		key = name
+	}
+	if f != nil {
+		// Different keys matching the same field are duplicates too.
+		key = f.name
+	}
+	return f, keys.add(key)
+}
+
 func decodeStructValue(d *Decoder, strct reflect.Value) error {
 	c, err := d.readCode()
 	if err != nil {
@@ -227,14 +420,25 @@ func decodeStructValue(d *Decoder, strct reflect.Value) error {
 	}
 
 	fields := structs.Fields(strct.Type())
+	fields.callDefaulter(strct)
 
 	if isArray {
+		if d.strictStructArrays && n != len(fields.List) {
+			if err := d.skipNext(n); err != nil {
+				return err
+			}
+			return fmt.Errorf("msgpack: array of %d elements does not match %d fields of %s",
+				n, len(fields.List), strct.Type())
+		}
+		var missing []string
 		for i, f := range fields.List {
 			if i >= n {
 				break
 			}
 			if err := f.DecodeValue(d, strct); err != nil {
-				return err
+				if !collectRequired(&missing, f.name, err) {
+					return err
+				}
 			}
 		}
 		// Skip extra values.
@@ -243,24 +447,74 @@ func decodeStructValue(d *Decoder, strct reflect.Value) error {
 				return err
 			}
 		}
-		return nil
+		return fields.finish(strct, fields.List[min(n, len(fields.List)):], missing)
 	}
 
+	if fields.idErr != nil {
+		if err := d.skipNext(2 * n); err != nil {
+			return err
+		}
+		return fields.idErr
+	}
+
+	var seen []bool
+	if len(fields.Required) > 0 || len(fields.Defaults) > 0 {
+		seen = make([]bool, len(fields.List))
+	}
+	var missing []string
+
+	keys := d.newKeySet(n)
 	for i := 0; i < n; i++ {
-		name, err := d.DecodeString()
+		var f *field
+		if keys == nil {
+			f, err = d.decodeField(fields)
+		} else {
+			f, err = d.decodeFieldKey(fields, keys)
+		}
 		if err != nil {
 			return err
 		}
-		if f := fields.Table[name]; f != nil {
-			if err := f.DecodeValue(d, strct); err != nil {
+		if f == nil {
+			if err := d.Skip(); err != nil {
 				return err
 			}
-		} else {
-			if err := d.Skip(); err != nil {
+			continue
+		}
+		if seen != nil {
+			seen[f.pos] = true
+		}
+		if err := f.DecodeValue(d, strct); err != nil {
+			if !collectRequired(&missing, f.name, err) {
 				return err
 			}
 		}
 	}
 
+	var absent []*field
+	if seen != nil {
+		for _, f := range fields.List {
+			if !seen[f.pos] {
+				absent = append(absent, f)
+			}
+		}
+	}
+	return fields.finish(strct, absent, missing)
+}
+
+// finish sets defaults of the fields absent in the decoded data and
+// returns *RequiredFieldsError if some of them are required or paths
+// of missing fields were collected from nested values.
+func (fs *fields) finish(strct reflect.Value, absent []*field, missing []string) error {
+	if err := fs.SetDefaults(strct, absent); err != nil {
+		return err
+	}
+	for _, f := range absent {
+		if f.required {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return &RequiredFieldsError{Paths: missing}
+	}
 	return nil
 }
@@ -125,6 +125,18 @@ func (d *Decoder) DecodeInt64() (int64, error) {
 	return d.int(c)
 }
 
+func isIntCode(c codes.Code) bool {
+	if codes.IsFixedNum(c) {
+		return true
+	}
+	switch c {
+	case codes.Uint8, codes.Uint16, codes.Uint32, codes.Uint64,
+		codes.Int8, codes.Int16, codes.Int32, codes.Int64:
+		return true
+	}
+	return false
+}
+
 func (d *Decoder) int(c codes.Code) (int64, error) {
 	if c == codes.Nil {
 		return 0, nil
@@ -172,7 +184,11 @@ func (d *Decoder) float32(c codes.Code) (float32, error) {
 		if err != nil {
 			return 0, err
 		}
-		return math.Float32frombits(n), nil
+		f := math.Float32frombits(n)
+		if err := d.checkFloat(float64(f)); err != nil {
+			return 0, err
+		}
+		return f, nil
 	}
 
 	n, err := d.int(c)
@@ -203,7 +219,11 @@ func (d *Decoder) float64(c codes.Code) (float64, error) {
 		if err != nil {
 			return 0, err
 		}
-		return math.Float64frombits(n), nil
+		f := math.Float64frombits(n)
+		if err := d.checkFloat(f); err != nil {
+			return 0, err
+		}
+		return f, nil
 	}
 
 	n, err := d.int(c)
@@ -213,6 +233,13 @@ func (d *Decoder) float64(c codes.Code) (float64, error) {
 	return float64(n), nil
 }
 
+func (d *Decoder) checkFloat(f float64) error {
+	if d.rejectNonFiniteFloats && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return fmt.Errorf("msgpack: non-finite float %v", f)
+	}
+	return nil
+}
+
 func (d *Decoder) DecodeUint() (uint, error) {
 	n, err := d.DecodeUint64()
 	return uint(n), err
@@ -3,6 +3,8 @@ package msgpack
 import (
 	"fmt"
 	"reflect"
+	"strconv"
+	"sync"
 
 	"github.com/vmihailenco/msgpack/codes"
 )
@@ -10,7 +12,10 @@ import (
 const sliceElemsAllocLimit = 1e4
 
 var sliceStringPtrType = reflect.TypeOf((*[]string)(nil))
+var sliceInterfaceType = reflect.TypeOf([]interface{}(nil))
 
+// DecodeArrayLen decodes the header of an array and returns the number
+// of elements that follow it, or -1 if the value is nil.
 func (d *Decoder) DecodeArrayLen() (int, error) {
 	c, err := d.readCode()
 	if err != nil {
@@ -28,10 +33,16 @@ func (d *Decoder) arrayLen(c codes.Code) (int, error) {
 	switch c {
 	case codes.Array16:
 		n, err := d.uint16()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkLen(int(n), 1)
 	case codes.Array32:
 		n, err := d.uint32()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkLen(int(n), 1)
 	}
 	return 0, fmt.Errorf("msgpack: invalid code=%x decoding array length", c)
 }
@@ -50,7 +61,13 @@ func (d *Decoder) decodeStringSlicePtr(ptr *[]string) error {
 		return nil
 	}
 
-	ss := setStringsCap(*ptr, n)
+	ss := *ptr
+	if cap(ss) < n {
+		if s, ok := d.makeSlice(sliceStringPtrType.Elem(), min(n, sliceElemsAllocLimit)); ok {
+			ss = s.Interface().([]string)
+		}
+	}
+	ss = setStringsCap(ss, n)
 	for i := 0; i < n; i++ {
 		s, err := d.DecodeString()
 		if err != nil {
@@ -81,38 +98,99 @@ func setStringsCap(s []string, n int) []string {
 	return s[:0]
 }
 
-func decodeSliceValue(d *Decoder, v reflect.Value) error {
-	n, err := d.DecodeArrayLen()
-	if err != nil {
-		return err
-	}
+// sliceDecoderFunc returns the decoder of slice type typ
+// with the element decoder resolved once.
+func sliceDecoderFunc(typ reflect.Type) decoderFunc {
+	decodeElem := lazyDecoder(typ.Elem())
+	return func(d *Decoder, v reflect.Value) error {
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
 
-	if n == -1 {
-		v.Set(reflect.Zero(v.Type()))
-		return nil
-	}
-	if n == 0 && v.IsNil() {
-		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		if n == -1 {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if n == 0 && v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+			return nil
+		}
+
+		if v.Cap() >= n {
+			v.Set(v.Slice(0, n))
+		} else if s, ok := d.makeSlice(v.Type(), min(n, sliceElemsAllocLimit)); ok {
+			reflect.Copy(s, v)
+			v.Set(s)
+		} else if v.Len() < v.Cap() {
+			v.Set(v.Slice(0, v.Cap()))
+		}
+
+		var missing []string
+		decode := decodeElem()
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				v.Set(growSliceValue(v, n))
+			}
+			if err := decode(d, v.Index(i)); err != nil {
+				if !collectRequired(&missing, "["+strconv.Itoa(i)+"]", err) {
+					return err
+				}
+			}
+		}
+
+		if len(missing) > 0 {
+			return &RequiredFieldsError{Paths: missing}
+		}
 		return nil
 	}
+}
 
-	if v.Cap() >= n {
-		v.Set(v.Slice(0, n))
-	} else if v.Len() < v.Cap() {
-		v.Set(v.Slice(0, v.Cap()))
-	}
+// arrayDecoderFunc returns the decoder of array type typ
+// with the element decoder resolved once.
+func arrayDecoderFunc(typ reflect.Type) decoderFunc {
+	decodeElem := lazyDecoder(typ.Elem())
+	return func(d *Decoder, v reflect.Value) error {
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return err
+		}
+		if n == -1 {
+			return nil
+		}
 
-	for i := 0; i < n; i++ {
-		if i >= v.Len() {
-			v.Set(growSliceValue(v, n))
+		if n > v.Len() {
+			return fmt.Errorf("%s len is %d, but msgpack has %d elements", v.Type(), v.Len(), n)
 		}
-		sv := v.Index(i)
-		if err := d.DecodeValue(sv); err != nil {
-			return err
+		var missing []string
+		decode := decodeElem()
+		for i := 0; i < n; i++ {
+			if err := decode(d, v.Index(i)); err != nil {
+				if !collectRequired(&missing, "["+strconv.Itoa(i)+"]", err) {
+					return err
+				}
+			}
+		}
+
+		if len(missing) > 0 {
+			return &RequiredFieldsError{Paths: missing}
 		}
+		return nil
 	}
+}
 
-	return nil
+// lazyDecoder returns a function that resolves the decoder of typ on
+// first use. The element type of a slice or an array may refer to
+// the slice itself, so its decoder can't be resolved eagerly.
+func lazyDecoder(typ reflect.Type) func() decoderFunc {
+	var once sync.Once
+	var decoder decoderFunc
+	return func() decoderFunc {
+		once.Do(func() {
+			decoder = getDecoder(typ)
+		})
+		return decoder
+	}
 }
 
 func growSliceValue(v reflect.Value, n int) reflect.Value {
@@ -124,12 +202,7 @@ func growSliceValue(v reflect.Value, n int) reflect.Value {
 	return v
 }
 
-func decodeArrayValue(d *Decoder, v reflect.Value) error {
-	n, err := d.DecodeArrayLen()
-	if err != nil {
-		return err
-	}
-
+func (d *Decoder) decodeArrayElems(v reflect.Value, n int) error {
 	if n == -1 {
 		return nil
 	}
@@ -147,6 +220,22 @@ func decodeArrayValue(d *Decoder, v reflect.Value) error {
 	return nil
 }
 
+// DecodeArrayFunc decodes the array length and calls fn for each element
+// with the element index. fn must decode exactly one value. Nil is decoded
+// as an empty array. The first error returned by fn is returned.
+func (d *Decoder) DecodeArrayFunc(fn func(i int, d *Decoder) error) error {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		if err := fn(i, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *Decoder) DecodeSlice() ([]interface{}, error) {
 	c, err := d.readCode()
 	if err != nil {
@@ -164,7 +253,12 @@ func (d *Decoder) decodeSlice(c codes.Code) ([]interface{}, error) {
 		return nil, nil
 	}
 
-	s := make([]interface{}, 0, min(n, sliceElemsAllocLimit))
+	var s []interface{}
+	if as, ok := d.makeSlice(sliceInterfaceType, min(n, sliceElemsAllocLimit)); ok {
+		s = as.Interface().([]interface{})[:0]
+	} else {
+		s = make([]interface{}, 0, min(n, sliceElemsAllocLimit))
+	}
 	for i := 0; i < n; i++ {
 		v, err := d.DecodeInterface()
 		if err != nil {
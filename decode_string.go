@@ -2,7 +2,10 @@ package msgpack
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"reflect"
+	"unicode/utf8"
 
 	"github.com/vmihailenco/msgpack/codes"
 )
@@ -16,13 +19,22 @@ func (d *Decoder) bytesLen(c codes.Code) (int, error) {
 	switch c {
 	case codes.Str8, codes.Bin8:
 		n, err := d.uint8()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkLen(int(n), 1)
 	case codes.Str16, codes.Bin16:
 		n, err := d.uint16()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkLen(int(n), 1)
 	case codes.Str32, codes.Bin32:
 		n, err := d.uint32()
-		return int(n), err
+		if err != nil {
+			return 0, err
+		}
+		return int(n), d.checkLen(int(n), 1)
 	}
 	return 0, fmt.Errorf("msgpack: invalid code=%x decoding bytes length", c)
 }
@@ -36,6 +48,9 @@ func (d *Decoder) DecodeString() (string, error) {
 }
 
 func (d *Decoder) string(c codes.Code) (string, error) {
+	if codes.IsExt(c) {
+		return d.dictKey(c)
+	}
 	n, err := d.bytesLen(c)
 	if err != nil {
 		return "", err
@@ -44,7 +59,16 @@ func (d *Decoder) string(c codes.Code) (string, error) {
 		return "", nil
 	}
 	b, err := d.readN(n)
-	return string(b), err
+	if err != nil {
+		return "", err
+	}
+	if d.validateUTF8 && !utf8.Valid(b) {
+		return "", ErrInvalidUTF8
+	}
+	if d.arena != nil {
+		return d.arena.string(b), nil
+	}
+	return string(b), nil
 }
 
 func decodeStringValue(d *Decoder, v reflect.Value) error {
@@ -56,6 +80,9 @@ func decodeStringValue(d *Decoder, v reflect.Value) error {
 	return nil
 }
 
+// DecodeBytesLen decodes the header of bin or str and returns the number
+// of bytes that follow it, or -1 if the value is nil. The caller must
+// read the bytes with ReadFull before decoding the next value.
 func (d *Decoder) DecodeBytesLen() (int, error) {
 	c, err := d.readCode()
 	if err != nil {
@@ -64,6 +91,16 @@ func (d *Decoder) DecodeBytesLen() (int, error) {
 	return d.bytesLen(c)
 }
 
+// ReadFull reads exactly len(b) bytes of the payload following
+// the header decoded by DecodeBytesLen.
+func (d *Decoder) ReadFull(b []byte) error {
+	err := d.readFull(b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 func (d *Decoder) DecodeBytes() ([]byte, error) {
 	c, err := d.readCode()
 	if err != nil {
@@ -72,6 +109,46 @@ func (d *Decoder) DecodeBytes() ([]byte, error) {
 	return d.bytes(c, nil)
 }
 
+// DecodeBytesTo decodes MessagePack bin or str and copies its content to w
+// without allocating a slice for it. It returns the number of bytes written.
+func (d *Decoder) DecodeBytesTo(w io.Writer) (int64, error) {
+	n, err := d.DecodeBytesLen()
+	if err != nil {
+		return 0, err
+	}
+	if n == -1 {
+		return 0, nil
+	}
+	written, err := d.copyN(w, int64(n))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return written, err
+}
+
+// DecodeBytesInto decodes MessagePack bin or str into buf and returns
+// the number of bytes decoded. If buf is too small, the value is skipped
+// and an error is returned.
+func (d *Decoder) DecodeBytesInto(buf []byte) (int, error) {
+	n, err := d.DecodeBytesLen()
+	if err != nil {
+		return 0, err
+	}
+	if n == -1 {
+		return 0, nil
+	}
+	if n > len(buf) {
+		if _, err := d.copyN(ioutil.Discard, int64(n)); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("msgpack: buffer len is %d, but msgpack has %d bytes", len(buf), n)
+	}
+	if err := d.readFull(buf[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 func (d *Decoder) bytes(c codes.Code, b []byte) ([]byte, error) {
 	n, err := d.bytesLen(c)
 	if err != nil {
@@ -80,7 +157,7 @@ func (d *Decoder) bytes(c codes.Code, b []byte) ([]byte, error) {
 	if n == -1 {
 		return nil, nil
 	}
-	return readN(d.r, b, n)
+	return readN(d.r, d.makeBytes(b, n), n)
 }
 
 func (d *Decoder) bytesNoCopy() ([]byte, error) {
@@ -88,6 +165,10 @@ func (d *Decoder) bytesNoCopy() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if codes.IsExt(c) {
+		s, err := d.dictKey(c)
+		return []byte(s), err
+	}
 	n, err := d.bytesLen(c)
 	if err != nil {
 		return nil, err
@@ -116,7 +197,7 @@ func (d *Decoder) bytesPtr(c codes.Code, ptr *[]byte) error {
 		return nil
 	}
 
-	*ptr, err = readN(d.r, *ptr, n)
+	*ptr, err = readN(d.r, d.makeBytes(*ptr, n), n)
 	return err
 }
 
@@ -151,6 +232,18 @@ func decodeByteArrayValue(d *Decoder, v reflect.Value) error {
 	if err != nil {
 		return err
 	}
+	return d.byteArray(c, v)
+}
+
+func (d *Decoder) byteArray(c codes.Code, v reflect.Value) error {
+	// Byte arrays used to be encoded as arrays of integers.
+	if codes.IsFixedArray(c) || c == codes.Array16 || c == codes.Array32 {
+		n, err := d.arrayLen(c)
+		if err != nil {
+			return err
+		}
+		return d.decodeArrayElems(v, n)
+	}
 
 	n, err := d.bytesLen(c)
 	if err != nil {
@@ -163,6 +256,12 @@ func decodeByteArrayValue(d *Decoder, v reflect.Value) error {
 		return fmt.Errorf("%s len is %d, but msgpack has %d elements", v.Type(), v.Len(), n)
 	}
 
-	b := v.Slice(0, n).Bytes()
-	return d.readFull(b)
+	b := v.Slice(0, v.Len()).Bytes()
+	if err := d.readFull(b[:n]); err != nil {
+		return err
+	}
+	for i := n; i < len(b); i++ {
+		b[i] = 0
+	}
+	return nil
 }
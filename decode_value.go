@@ -29,23 +29,27 @@ func init() {
 		reflect.Float64:       decodeFloat64Value,
 		reflect.Complex64:     decodeUnsupportedValue,
 		reflect.Complex128:    decodeUnsupportedValue,
-		reflect.Array:         decodeArrayValue,
 		reflect.Chan:          decodeUnsupportedValue,
 		reflect.Func:          decodeUnsupportedValue,
 		reflect.Interface:     decodeInterfaceValue,
 		reflect.Map:           decodeMapValue,
 		reflect.Ptr:           decodeUnsupportedValue,
-		reflect.Slice:         decodeSliceValue,
 		reflect.String:        decodeStringValue,
 		reflect.Struct:        decodeStructValue,
 		reflect.UnsafePointer: decodeUnsupportedValue,
 	}
 }
 
+// getDecoder returns the decoder of typ. Decoders are built once per
+// type and cached until registered types change.
 func getDecoder(typ reflect.Type) decoderFunc {
+	return decoders.Decoder(typ)
+}
+
+func newDecoder(typ reflect.Type) decoderFunc {
 	kind := typ.Kind()
 
-	if decoder, ok := typDecMap[typ]; ok {
+	if decoder, ok := registeredDecoder(typ); ok {
 		return decoder
 	}
 
@@ -80,10 +84,12 @@ func getDecoder(typ reflect.Type) decoderFunc {
 		case stringType:
 			return decodeStringSliceValue
 		}
+		return sliceDecoderFunc(typ)
 	case reflect.Array:
 		if typ.Elem().Kind() == reflect.Uint8 {
 			return decodeByteArrayValue
 		}
+		return arrayDecoderFunc(typ)
 	case reflect.Map:
 		if typ.Key() == stringType {
 			switch typ.Elem() {
@@ -104,6 +110,11 @@ func ptrDecoderFunc(typ reflect.Type) decoderFunc {
 			v.Set(reflect.Zero(v.Type()))
 			return d.DecodeNil()
 		}
+		if d.sharedRefs {
+			if done, err := d.decodeSharedRef(v, decoder); done || err != nil {
+				return err
+			}
+		}
 		if v.IsNil() {
 			if !v.CanSet() {
 				return fmt.Errorf("msgpack: Decode(nonsettable %T)", v.Interface())
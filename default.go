@@ -0,0 +1,103 @@
+package msgpack
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Defaulter is implemented by structs that set default values of their
+// fields. SetDefaults is called before a map or an array is decoded
+// into the struct, so fields missing from the data keep the defaults.
+// Values the struct held before decoding are overwritten by SetDefaults.
+type Defaulter interface {
+	SetDefaults()
+}
+
+var defaulterType = reflect.TypeOf((*Defaulter)(nil)).Elem()
+
+// parseDefault parses the value of a default= tag option
+// for a field of type typ.
+func parseDefault(typ reflect.Type, s string) (reflect.Value, error) {
+	v := reflect.New(typ).Elem()
+	var err error
+	switch typ.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if typ == durationType {
+			var d time.Duration
+			d, err = time.ParseDuration(s)
+			v.SetInt(int64(d))
+			break
+		}
+		var n int64
+		n, err = strconv.ParseInt(s, 0, typ.Bits())
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(s, 0, typ.Bits())
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(s, typ.Bits())
+		v.SetFloat(f)
+	default:
+		return reflect.Value{}, fmt.Errorf("msgpack: default value is not supported for %s", typ)
+	}
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("msgpack: invalid default %q for %s: %s", s, typ, err)
+	}
+	return v, nil
+}
+
+// SetDefaults sets fields with default= tag options that are absent
+// in the decoded data to their defaults. Nil pointers to embedded structs holding such fields
+// are allocated.
+func (fs *fields) SetDefaults(strct reflect.Value, absent []*field) error {
+	for _, f := range fs.Defaults {
+		if f.defaultErr != nil {
+			return f.defaultErr
+		}
+	}
+	for _, f := range absent {
+		if !f.defaultValue.IsValid() {
+			continue
+		}
+		if v, ok := fieldByIndexAlloc(strct, f.index); ok {
+			v.Set(f.defaultValue)
+		}
+	}
+	return nil
+}
+
+// callDefaulter calls SetDefaults if the struct is a Defaulter.
+func (fs *fields) callDefaulter(strct reflect.Value) {
+	if fs.defaulter && strct.CanAddr() {
+		strct.Addr().Interface().(Defaulter).SetDefaults()
+	}
+}
+
+// fieldByIndexAlloc is like reflect.Value.FieldByIndex, but allocates
+// nil pointers to embedded structs on the way. It returns false
+// if such a pointer can't be set.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
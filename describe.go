@@ -0,0 +1,74 @@
+package msgpack
+
+import (
+	"reflect"
+	"time"
+)
+
+var builtinExtIds = map[reflect.Type]int8{
+	reflect.TypeOf(time.Time{}): timeExtId,
+	reflect.TypeOf(UUID{}):      uuidExtId,
+	reflect.TypeOf(Decimal{}):   decimalExtId,
+}
+
+// StructField describes how a struct field is encoded.
+type StructField struct {
+	// Name is the map key the field is encoded with.
+	Name string
+	// Index is the index sequence for reflect.Value.FieldByIndex.
+	Index []int
+	Type  reflect.Type
+	// Tag is the msgpack tag of the field.
+	Tag       string
+	OmitEmpty bool
+}
+
+// StructFields returns fields of struct type typ in the order they are
+// encoded and reports whether the struct is encoded as an array.
+func StructFields(typ reflect.Type) (fields []StructField, asArray bool) {
+	fs := structs.Fields(typ)
+	fields = make([]StructField, len(fs.List))
+	for i, f := range fs.List {
+		sf := typ.FieldByIndex(f.index)
+		fields[i] = StructField{
+			Name:      f.name,
+			Index:     append([]int(nil), f.index...),
+			Type:      sf.Type,
+			Tag:       sf.Tag.Get("msgpack"),
+			OmitEmpty: f.omitEmpty,
+		}
+	}
+	return fields, fs.asArray
+}
+
+// ExtID reports the extension type id values of typ are encoded with,
+// either because typ is registered with RegisterExt or because it is
+// one of the types this package encodes as extensions.
+func ExtID(typ reflect.Type) (int8, bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	for id, t := range extTypes {
+		if t == typ {
+			return id, true
+		}
+	}
+	id, ok := builtinExtIds[typ]
+	return id, ok
+}
+
+// HasCustomEncoding reports whether values of typ are encoded by
+// a registered encoder, CustomEncoder or Marshaler instead of
+// according to their kind.
+func HasCustomEncoding(typ reflect.Type) bool {
+	if _, ok := registeredEncoder(typ); ok {
+		return true
+	}
+	if typ.Implements(customEncoderType) || typ.Implements(marshalerType) {
+		return true
+	}
+	if typ.Kind() != reflect.Ptr {
+		ptr := reflect.PtrTo(typ)
+		return ptr.Implements(customEncoderType) || ptr.Implements(marshalerType)
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+package msgpack
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+type DiffKind int
+
+const (
+	DiffAdded DiffKind = iota + 1
+	DiffRemoved
+	DiffChanged
+)
+
+func (k DiffKind) String() string {
+	switch k {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	}
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+// Difference describes a value that differs between two encoded values.
+type Difference struct {
+	// Path to the value in the format used by Query, e.g. key1.0.key2.
+	// Path of the top-level value is empty.
+	Path string
+	Kind DiffKind
+
+	// A and B are MessagePack encodings of the value in a and b.
+	// A is nil for added values and B is nil for removed values.
+	A []byte
+	B []byte
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s %s", d.Kind, d.Path)
+}
+
+// Diff compares MessagePack encoded values a and b and returns paths
+// of added, removed and changed values. Maps are compared key by key
+// and arrays element by element; values with different encodings of the
+// same value, e.g. 1 encoded as fixnum and uint8, are considered equal.
+func Diff(a, b []byte) ([]Difference, error) {
+	var diffs []Difference
+	if err := diffRaw(&diffs, "", a, b); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+func diffRaw(diffs *[]Difference, path string, a, b []byte) error {
+	if isRawMap(a) && isRawMap(b) {
+		return diffRawMaps(diffs, path, a, b)
+	}
+	if isRawArray(a) && isRawArray(b) {
+		return diffRawArrays(diffs, path, a, b)
+	}
+	if !rawEqual(a, b) {
+		*diffs = append(*diffs, Difference{
+			Path: path,
+			Kind: DiffChanged,
+			A:    a,
+			B:    b,
+		})
+	}
+	return nil
+}
+
+func diffRawMaps(diffs *[]Difference, path string, a, b []byte) error {
+	aEntries, err := decodeRawMap(a)
+	if err != nil {
+		return err
+	}
+	bEntries, err := decodeRawMap(b)
+	if err != nil {
+		return err
+	}
+
+	bIndex := make(map[string]int, len(bEntries))
+	for i, entry := range bEntries {
+		bIndex[entry.id] = i
+	}
+
+	seen := make(map[string]bool, len(aEntries))
+	for _, ae := range aEntries {
+		seen[ae.id] = true
+
+		keyPath, err := joinRawKeyPath(path, ae.key)
+		if err != nil {
+			return err
+		}
+
+		i, ok := bIndex[ae.id]
+		if !ok {
+			*diffs = append(*diffs, Difference{
+				Path: keyPath,
+				Kind: DiffRemoved,
+				A:    ae.value,
+			})
+			continue
+		}
+
+		if err := diffRaw(diffs, keyPath, ae.value, bEntries[i].value); err != nil {
+			return err
+		}
+	}
+
+	for _, be := range bEntries {
+		if seen[be.id] {
+			continue
+		}
+		keyPath, err := joinRawKeyPath(path, be.key)
+		if err != nil {
+			return err
+		}
+		*diffs = append(*diffs, Difference{
+			Path: keyPath,
+			Kind: DiffAdded,
+			B:    be.value,
+		})
+	}
+
+	return nil
+}
+
+func diffRawArrays(diffs *[]Difference, path string, a, b []byte) error {
+	aElems, err := decodeRawArray(a)
+	if err != nil {
+		return err
+	}
+	bElems, err := decodeRawArray(b)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(aElems) || i < len(bElems); i++ {
+		elemPath := joinPath(path, fmt.Sprint(i))
+		switch {
+		case i >= len(bElems):
+			*diffs = append(*diffs, Difference{
+				Path: elemPath,
+				Kind: DiffRemoved,
+				A:    aElems[i],
+			})
+		case i >= len(aElems):
+			*diffs = append(*diffs, Difference{
+				Path: elemPath,
+				Kind: DiffAdded,
+				B:    bElems[i],
+			})
+		default:
+			if err := diffRaw(diffs, elemPath, aElems[i], bElems[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func rawEqual(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+
+	av, err := NewDecoder(bytes.NewReader(a)).DecodeInterface()
+	if err != nil {
+		return false
+	}
+	bv, err := NewDecoder(bytes.NewReader(b)).DecodeInterface()
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
+
+func isRawArray(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	c := codes.Code(b[0])
+	return codes.IsFixedArray(c) || c == codes.Array16 || c == codes.Array32
+}
+
+func decodeRawArray(b []byte) ([][]byte, error) {
+	d := NewDecoder(bytes.NewReader(b))
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	elems := make([][]byte, 0, min(n, sliceElemsAllocLimit))
+	for i := 0; i < n; i++ {
+		elem, err := d.readRaw()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+func joinRawKeyPath(path string, key []byte) (string, error) {
+	k, err := NewDecoder(bytes.NewReader(key)).DecodeInterface()
+	if err != nil {
+		return "", err
+	}
+	return joinPath(path, fmt.Sprint(k)), nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
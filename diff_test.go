@@ -0,0 +1,68 @@
+package msgpack_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestDiff(t *testing.T) {
+	a := mustMarshalSorted(t, map[string]interface{}{
+		"id":    1,
+		"name":  "foo",
+		"tags":  []string{"a", "b"},
+		"attrs": map[string]interface{}{"phone": 12345},
+	})
+	b := mustMarshalSorted(t, map[string]interface{}{
+		"id":    uint64(1),
+		"tags":  []string{"a", "c", "d"},
+		"attrs": map[string]interface{}{"phone": 54321, "email": "foo@bar"},
+	})
+
+	diffs, err := msgpack.Diff(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, d := range diffs {
+		got = append(got, d.String())
+	}
+	wanted := []string{
+		"changed attrs.phone",
+		"added attrs.email",
+		"removed name",
+		"changed tags.1",
+		"added tags.2",
+	}
+	if !reflect.DeepEqual(got, wanted) {
+		t.Fatalf("got %q, wanted %q", got, wanted)
+	}
+
+	var phone int
+	if err := msgpack.Unmarshal(diffs[0].B, &phone); err != nil {
+		t.Fatal(err)
+	}
+	if phone != 54321 {
+		t.Fatalf("got %d, wanted 54321", phone)
+	}
+}
+
+func TestDiffEqual(t *testing.T) {
+	for _, v := range []interface{}{
+		nil,
+		"hello",
+		[]interface{}{1, "two", 3.0},
+		map[string]interface{}{"foo": map[string]interface{}{"bar": 1}},
+	} {
+		b := mustMarshalSorted(t, v)
+		diffs, err := msgpack.Diff(b, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(diffs) != 0 {
+			t.Fatalf("got %v, wanted no differences (v=%v)", diffs, v)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+var durationExtId int8 = -125
+
+var durationType = reflect.TypeOf((*time.Duration)(nil)).Elem()
+
+func init() {
+	registerBuiltin(durationType, encodeDurationValue, decodeDurationValue)
+}
+
+// UseDurationExt causes the Encoder to encode time.Duration as fixext8
+// with nanoseconds instead of int, so durations decoded into interface{}
+// are returned as time.Duration.
+func (e *Encoder) UseDurationExt(v bool) *Encoder {
+	e.useDurationExt = v
+	return e
+}
+
+func (e *Encoder) EncodeDuration(d time.Duration) error {
+	if !e.useDurationExt {
+		return e.EncodeInt(int64(d))
+	}
+
+	if err := e.writeCode(codes.FixExt8); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(byte(durationExtId)); err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(d))
+	return e.write(b[:])
+}
+
+// DecodeDuration decodes time.Duration encoded as int with nanoseconds
+// or as ext. Strings accepted by time.ParseDuration, e.g. "1h30m",
+// are supported as well.
+func (d *Decoder) DecodeDuration() (time.Duration, error) {
+	c, err := d.readCode()
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case codes.IsExt(c):
+		n, err := d.parseExtLen(c)
+		if err != nil {
+			return 0, err
+		}
+		id, err := d.readCode()
+		if err != nil {
+			return 0, err
+		}
+		if int8(id) != durationExtId {
+			return 0, fmt.Errorf("msgpack: invalid ext id=%d decoding duration", int8(id))
+		}
+		return d.duration(n)
+	case isStringCode(c):
+		s, err := d.string(c)
+		if err != nil {
+			return 0, err
+		}
+		return time.ParseDuration(s)
+	default:
+		n, err := d.int(c)
+		return time.Duration(n), err
+	}
+}
+
+func (d *Decoder) duration(extLen int) (time.Duration, error) {
+	if extLen != 8 {
+		return 0, fmt.Errorf("msgpack: invalid ext len=%d decoding duration", extLen)
+	}
+	b, err := d.readN(extLen)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(binary.BigEndian.Uint64(b)), nil
+}
+
+func encodeDurationValue(e *Encoder, v reflect.Value) error {
+	return e.EncodeDuration(time.Duration(v.Int()))
+}
+
+func decodeDurationValue(d *Decoder, v reflect.Value) error {
+	dur, err := d.DecodeDuration()
+	if err != nil {
+		return err
+	}
+	v.SetInt(int64(dur))
+	return nil
+}
@@ -2,6 +2,7 @@ package msgpack
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"reflect"
 	"time"
@@ -38,9 +39,33 @@ func Marshal(v ...interface{}) ([]byte, error) {
 type Encoder struct {
 	w   writer
 	buf []byte
+	ctx context.Context
 
-	sortMapKeys   bool
-	structAsArray bool
+	sortMapKeys      bool
+	sortStructFields bool
+	structAsArray    bool
+	useDurationExt   bool
+	useRFC3339Time   bool
+	useZonedTime     bool
+	validateUTF8     bool
+
+	rejectNonFiniteFloats bool
+	nonFiniteFloatsAsNil  bool
+
+	detectCycles bool
+	visiting     map[visitKey]struct{}
+	path         []string
+
+	sharedRefs bool
+	refs       map[visitKey]int
+
+	compatibleEncoding bool
+	intKeys            bool
+
+	keyDict bool
+	keys    map[string]int
+
+	stats *statsCollector
 }
 
 func NewEncoder(w io.Writer) *Encoder {
@@ -55,14 +80,67 @@ func NewEncoder(w io.Writer) *Encoder {
 }
 
 // SortMapKeys causes the Encoder to encode map keys in increasing order.
-// Supported map types are:
-//   - map[string]string
-//   - map[string]interface{}
+// Strings, numbers and booleans are compared by value and other keys,
+// e.g. structs, by their encoding.
 func (e *Encoder) SortMapKeys(v bool) *Encoder {
 	e.sortMapKeys = v
 	return e
 }
 
+// SortStructFields causes the Encoder to encode struct fields sorted
+// by name instead of the declaration order. It is useful to get
+// canonical output, e.g. for hashing. Structs encoded as arrays
+// always use the declaration order.
+func (e *Encoder) SortStructFields(v bool) *Encoder {
+	e.sortStructFields = v
+	return e
+}
+
+// UseIntKeys causes the Encoder to encode struct fields with numeric
+// tags, e.g. `msgpack:"1"`, using the number as an integer map key
+// instead of a string. Messages get smaller and Go fields can be renamed
+// without breaking compatibility. Fields without numeric tags are still
+// keyed by name. Decoder accepts both forms when decoding into structs;
+// DecodeInterface decodes such maps as map[interface{}]interface{}.
+// Structs with several fields having the same numeric tag can't be
+// encoded or decoded as maps.
+func (e *Encoder) UseIntKeys(v bool) *Encoder {
+	e.intKeys = v
+	return e
+}
+
+// UseCompatibleEncoding causes the Encoder to use the old MessagePack
+// format understood by peers that don't support str8 and bin types:
+// strings and bytes are encoded as raw (fixstr, str16 and str32) and
+// time.Time is encoded as an array of seconds and nanoseconds.
+// UseCompatibleEncoding(false) restores the current spec. Decoder
+// accepts both formats.
+func (e *Encoder) UseCompatibleEncoding(v bool) *Encoder {
+	e.compatibleEncoding = v
+	return e
+}
+
+// ValidateUTF8 causes the Encoder to return an error when a string
+// is not valid UTF-8 as required by the MessagePack str type.
+func (e *Encoder) ValidateUTF8(v bool) *Encoder {
+	e.validateUTF8 = v
+	return e
+}
+
+// RejectNonFiniteFloats causes the Encoder to return an error
+// when it encodes NaN or ±Inf.
+func (e *Encoder) RejectNonFiniteFloats(v bool) *Encoder {
+	e.rejectNonFiniteFloats = v
+	return e
+}
+
+// NonFiniteFloatsAsNil causes the Encoder to encode NaN and ±Inf as nil.
+// It takes precedence over RejectNonFiniteFloats.
+func (e *Encoder) NonFiniteFloatsAsNil(v bool) *Encoder {
+	e.nonFiniteFloatsAsNil = v
+	return e
+}
+
 // StructAsArray causes the Encoder to encode Go structs as MessagePack arrays.
 func (e *Encoder) StructAsArray(v bool) *Encoder {
 	e.structAsArray = v
@@ -71,6 +149,15 @@ func (e *Encoder) StructAsArray(v bool) *Encoder {
 
 func (e *Encoder) Encode(v ...interface{}) error {
 	for _, vv := range v {
+		if e.stats != nil {
+			start := e.stats.begin()
+			err := e.encode(vv)
+			e.stats.end(start, reflect.TypeOf(vv), err)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 		if err := e.encode(vv); err != nil {
 			return err
 		}
@@ -79,31 +166,34 @@ func (e *Encoder) Encode(v ...interface{}) error {
 }
 
 func (e *Encoder) encode(v interface{}) error {
-	switch v := v.(type) {
-	case nil:
+	if v == nil {
 		return e.EncodeNil()
-	case string:
-		return e.EncodeString(v)
-	case []byte:
-		return e.EncodeBytes(v)
-	case int:
-		return e.EncodeInt(int64(v))
-	case int64:
-		return e.EncodeInt(v)
-	case uint:
-		return e.EncodeUint(uint64(v))
-	case uint64:
-		return e.EncodeUint(v)
-	case bool:
-		return e.EncodeBool(v)
-	case float32:
-		return e.EncodeFloat32(v)
-	case float64:
-		return e.EncodeFloat64(v)
-	case time.Duration:
-		return e.EncodeInt(int64(v))
-	case time.Time:
-		return e.EncodeTime(v)
+	}
+	if useFastPath() {
+		switch v := v.(type) {
+		case string:
+			return e.EncodeString(v)
+		case []byte:
+			return e.EncodeBytes(v)
+		case int:
+			return e.EncodeInt(int64(v))
+		case int64:
+			return e.EncodeInt(v)
+		case uint:
+			return e.EncodeUint(uint64(v))
+		case uint64:
+			return e.EncodeUint(v)
+		case bool:
+			return e.EncodeBool(v)
+		case float32:
+			return e.EncodeFloat32(v)
+		case float64:
+			return e.EncodeFloat64(v)
+		case time.Duration:
+			return e.EncodeDuration(v)
+		case time.Time:
+			return e.EncodeTime(v)
+		}
 	}
 	return e.EncodeValue(reflect.ValueOf(v))
 }
@@ -1,8 +1,11 @@
 package msgpack
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
 	"sort"
+	"sync"
 
 	"github.com/vmihailenco/msgpack/codes"
 )
@@ -11,16 +14,49 @@ func encodeMapValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
 	}
+	if e.detectCycles {
+		if err := e.enter(v); err != nil {
+			return err
+		}
+		defer e.leave(v)
+	}
 
 	if err := e.EncodeMapLen(v.Len()); err != nil {
 		return err
 	}
 
-	for _, key := range v.MapKeys() {
-		if err := e.EncodeValue(key); err != nil {
+	keyType := v.Type().Key()
+	keys := v.MapKeys()
+	if e.sortMapKeys {
+		if err := sortMapKeys(keys); err != nil {
 			return err
 		}
-		if err := e.EncodeValue(v.MapIndex(key)); err != nil {
+	}
+
+	stringKeys := keyType == stringType
+	structKeys := keyType.Kind() == reflect.Struct &&
+		reflect.ValueOf(getEncoder(keyType)).Pointer() == structEncoderPtr
+	for _, key := range keys {
+		var err error
+		switch {
+		case stringKeys:
+			err = e.encodeMapKey(key.String())
+		case structKeys:
+			// Struct keys are encoded as arrays to be compact
+			// and independent of the encoder options.
+			err = encodeStructValueAsArray(e, key, structs.Fields(keyType).List)
+		default:
+			err = e.EncodeValue(key)
+		}
+		if err != nil {
+			return err
+		}
+		if e.detectCycles {
+			e.pushPath(fmt.Sprint(key.Interface()))
+		}
+		err = e.EncodeValue(v.MapIndex(key))
+		e.popPath()
+		if err != nil {
 			return err
 		}
 	}
@@ -28,6 +64,65 @@ func encodeMapValue(e *Encoder, v reflect.Value) error {
 	return nil
 }
 
+// sortMapKeys sorts keys of a map in increasing order.
+func sortMapKeys(keys []reflect.Value) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	sorter := &mapKeySorter{keys: keys}
+	switch keys[0].Kind() {
+	case reflect.String:
+		sorter.less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sorter.less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		sorter.less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+	case reflect.Float32, reflect.Float64:
+		sorter.less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+	case reflect.Bool:
+		sorter.less = func(a, b reflect.Value) bool { return !a.Bool() && b.Bool() }
+	default:
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		sorter.encoded = make([]string, len(keys))
+		for i, key := range keys {
+			buf.Reset()
+			if err := enc.EncodeValue(key); err != nil {
+				return err
+			}
+			sorter.encoded[i] = buf.String()
+		}
+	}
+	sort.Sort(sorter)
+	return nil
+}
+
+// mapKeySorter sorts map keys using less or, if it is nil,
+// by their encoding.
+type mapKeySorter struct {
+	keys    []reflect.Value
+	encoded []string
+	less    func(a, b reflect.Value) bool
+}
+
+func (s *mapKeySorter) Len() int {
+	return len(s.keys)
+}
+
+func (s *mapKeySorter) Less(i, j int) bool {
+	if s.less == nil {
+		return s.encoded[i] < s.encoded[j]
+	}
+	return s.less(s.keys[i], s.keys[j])
+}
+
+func (s *mapKeySorter) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	if s.encoded != nil {
+		s.encoded[i], s.encoded[j] = s.encoded[j], s.encoded[i]
+	}
+}
+
 func encodeMapStringStringValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
@@ -43,7 +138,7 @@ func encodeMapStringStringValue(e *Encoder, v reflect.Value) error {
 	}
 
 	for mk, mv := range m {
-		if err := e.EncodeString(mk); err != nil {
+		if err := e.encodeMapKey(mk); err != nil {
 			return err
 		}
 		if err := e.EncodeString(mv); err != nil {
@@ -58,6 +153,12 @@ func encodeMapStringInterfaceValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
 	}
+	if e.detectCycles {
+		if err := e.enter(v); err != nil {
+			return err
+		}
+		defer e.leave(v)
+	}
 
 	if err := e.EncodeMapLen(v.Len()); err != nil {
 		return err
@@ -69,10 +170,13 @@ func encodeMapStringInterfaceValue(e *Encoder, v reflect.Value) error {
 	}
 
 	for mk, mv := range m {
-		if err := e.EncodeString(mk); err != nil {
+		if err := e.encodeMapKey(mk); err != nil {
 			return err
 		}
-		if err := e.Encode(mv); err != nil {
+		e.pushPath(mk)
+		err := e.encodeInterface(mv)
+		e.popPath()
+		if err != nil {
 			return err
 		}
 	}
@@ -88,7 +192,7 @@ func (e *Encoder) encodeSortedMapStringString(m map[string]string) error {
 	sort.Strings(keys)
 
 	for _, k := range keys {
-		err := e.EncodeString(k)
+		err := e.encodeMapKey(k)
 		if err != nil {
 			return err
 		}
@@ -108,11 +212,14 @@ func (e *Encoder) encodeSortedMapStringInterface(m map[string]interface{}) error
 	sort.Strings(keys)
 
 	for _, k := range keys {
-		err := e.EncodeString(k)
+		err := e.encodeMapKey(k)
 		if err != nil {
 			return err
 		}
-		if err = e.Encode(m[k]); err != nil {
+		e.pushPath(k)
+		err = e.encodeInterface(m[k])
+		e.popPath()
+		if err != nil {
 			return err
 		}
 	}
@@ -120,6 +227,8 @@ func (e *Encoder) encodeSortedMapStringInterface(m map[string]interface{}) error
 	return nil
 }
 
+// EncodeMapLen encodes the header of a map with l entries.
+// It must be followed by exactly l encoded key and value pairs.
 func (e *Encoder) EncodeMapLen(l int) error {
 	if l < 16 {
 		return e.writeCode(codes.FixedMapLow | codes.Code(l))
@@ -130,27 +239,79 @@ func (e *Encoder) EncodeMapLen(l int) error {
 	return e.write4(codes.Map32, uint32(l))
 }
 
-func encodeStructValue(e *Encoder, strct reflect.Value) error {
-	structFields := structs.Fields(strct.Type())
-	if e.structAsArray || structFields.asArray {
-		return encodeStructValueAsArray(e, strct, structFields.List)
-	}
-	fields := structFields.OmitEmpty(strct)
-
-	if err := e.EncodeMapLen(len(fields)); err != nil {
-		return err
-	}
+// structEncoderFunc returns the encoder of struct type typ. Fields are
+// resolved on first use because field types may refer to typ itself.
+func structEncoderFunc(typ reflect.Type) encoderFunc {
+	var once sync.Once
+	var fs *fields
+	return func(e *Encoder, strct reflect.Value) error {
+		once.Do(func() {
+			fs = structs.Fields(typ)
+		})
+		if e.structAsArray || fs.asArray {
+			return encodeStructValueAsArray(e, strct, fs.List)
+		}
+		if fs.idErr != nil {
+			return fs.idErr
+		}
 
-	for _, f := range fields {
-		if err := e.EncodeString(f.name); err != nil {
-			return err
+		list := fs.List
+		if e.sortStructFields {
+			list = fs.Sorted
+		}
+		n := len(list)
+		if fs.omitEmpty {
+			for _, f := range list {
+				if f.Omit(strct) {
+					n--
+				}
+			}
 		}
-		if err := f.EncodeValue(e, strct); err != nil {
+		if err := e.EncodeMapLen(n); err != nil {
 			return err
 		}
+
+		for _, f := range list {
+			if fs.omitEmpty && f.Omit(strct) {
+				continue
+			}
+			if err := e.encodeFieldName(f); err != nil {
+				return err
+			}
+			if !e.detectCycles {
+				if err := f.EncodeValue(e, strct); err != nil {
+					return err
+				}
+				continue
+			}
+			e.pushPath(f.name)
+			err := f.EncodeValue(e, strct)
+			e.popPath()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// encodeFieldName writes the key of the struct field: its id when
+// UseIntKeys is set or its name, using the encoding precomputed
+// for the default options when possible.
+func (e *Encoder) encodeFieldName(f *field) error {
+	if e.intKeys && f.id > 0 {
+		return e.EncodeInt(f.id)
+	}
+	if e.keyDict || e.compatibleEncoding || e.validateUTF8 {
+		return e.encodeMapKey(f.name)
 	}
+	return e.write(f.encodedName)
+}
 
-	return nil
+func encodeFieldName(name string) []byte {
+	var buf bytes.Buffer
+	_ = NewEncoder(&buf).EncodeString(name)
+	return buf.Bytes()
 }
 
 func encodeStructValueAsArray(e *Encoder, strct reflect.Value, fields []*field) error {
@@ -158,7 +319,10 @@ func encodeStructValueAsArray(e *Encoder, strct reflect.Value, fields []*field)
 		return err
 	}
 	for _, f := range fields {
-		if err := f.EncodeValue(e, strct); err != nil {
+		e.pushPath(f.name)
+		err := f.EncodeValue(e, strct)
+		e.popPath()
+		if err != nil {
 			return err
 		}
 	}
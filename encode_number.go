@@ -1,8 +1,10 @@
 package msgpack
 
 import (
+	"fmt"
 	"math"
 	"reflect"
+	"strconv"
 
 	"github.com/vmihailenco/msgpack/codes"
 )
@@ -44,14 +46,76 @@ func (e *Encoder) EncodeInt(v int64) error {
 	return e.write8(codes.Int64, uint64(v))
 }
 
+// encodeFixedInt encodes n as int with exactly the number of bits.
+func (e *Encoder) encodeFixedInt(n int64, bits int) error {
+	switch bits {
+	case 8:
+		if n >= math.MinInt8 && n <= math.MaxInt8 {
+			return e.write1(codes.Int8, uint64(n))
+		}
+	case 16:
+		if n >= math.MinInt16 && n <= math.MaxInt16 {
+			return e.write2(codes.Int16, uint64(n))
+		}
+	case 32:
+		if n >= math.MinInt32 && n <= math.MaxInt32 {
+			return e.write4(codes.Int32, uint32(n))
+		}
+	case 64:
+		return e.write8(codes.Int64, uint64(n))
+	}
+	return fmt.Errorf("msgpack: %d overflows int%d", n, bits)
+}
+
+// encodeFixedUint encodes n as uint with exactly the number of bits.
+func (e *Encoder) encodeFixedUint(n uint64, bits int) error {
+	switch bits {
+	case 8:
+		if n <= math.MaxUint8 {
+			return e.write1(codes.Uint8, n)
+		}
+	case 16:
+		if n <= math.MaxUint16 {
+			return e.write2(codes.Uint16, n)
+		}
+	case 32:
+		if n <= math.MaxUint32 {
+			return e.write4(codes.Uint32, uint32(n))
+		}
+	case 64:
+		return e.write8(codes.Uint64, n)
+	}
+	return fmt.Errorf("msgpack: %d overflows uint%d", n, bits)
+}
+
 func (e *Encoder) EncodeFloat32(n float32) error {
+	if isNonFinite(float64(n)) {
+		if e.nonFiniteFloatsAsNil {
+			return e.EncodeNil()
+		}
+		if e.rejectNonFiniteFloats {
+			return fmt.Errorf("msgpack: can't encode non-finite float %v", n)
+		}
+	}
 	return e.write4(codes.Float, math.Float32bits(n))
 }
 
 func (e *Encoder) EncodeFloat64(n float64) error {
+	if isNonFinite(n) {
+		if e.nonFiniteFloatsAsNil {
+			return e.EncodeNil()
+		}
+		if e.rejectNonFiniteFloats {
+			return fmt.Errorf("msgpack: can't encode non-finite float %v", n)
+		}
+	}
 	return e.write8(codes.Double, math.Float64bits(n))
 }
 
+func isNonFinite(n float64) bool {
+	return math.IsNaN(n) || math.IsInf(n, 0)
+}
+
 func (e *Encoder) write1(code codes.Code, n uint64) error {
 	e.buf = e.buf[:2]
 	e.buf[0] = byte(code)
@@ -106,3 +170,78 @@ func encodeFloat32Value(e *Encoder, v reflect.Value) error {
 func encodeFloat64Value(e *Encoder, v reflect.Value) error {
 	return e.EncodeFloat64(v.Float())
 }
+
+// fixedIntEncoder returns encoder for integer type typ configured with
+// the field tag options:
+//   - as_int8, as_int16, as_int32 and as_int64 encode the value as int
+//     with the number of bits,
+//   - as_uint8, as_uint16, as_uint32 and as_uint64 encode the value as uint
+//     with the number of bits,
+//   - fixed8, fixed16, fixed32 and fixed64 encode the value with
+//     the number of bits keeping the signedness of typ,
+//   - fixed encodes the value with the size and signedness of typ.
+//
+// It returns nil if none of the options is set.
+func fixedIntEncoder(typ reflect.Type, opt tagOptions) encoderFunc {
+	signed := isIntKind(typ.Kind())
+	isInt := signed || isUintKind(typ.Kind())
+
+	var name, bitsStr string
+	if s, ok := opt.Get("as_int"); ok {
+		name, bitsStr, signed = "as_int"+s, s, true
+	} else if s, ok := opt.Get("as_uint"); ok {
+		name, bitsStr, signed = "as_uint"+s, s, false
+	} else if s, ok := opt.Get("fixed"); ok {
+		name, bitsStr = "fixed"+s, s
+		if s == "" && isInt {
+			bitsStr = strconv.Itoa(typ.Bits())
+		}
+	} else {
+		return nil
+	}
+
+	bits, _ := strconv.Atoi(bitsStr)
+	if !isInt || bits != 8 && bits != 16 && bits != 32 && bits != 64 {
+		return func(e *Encoder, v reflect.Value) error {
+			return fmt.Errorf("msgpack: invalid tag option %q for %s", name, typ)
+		}
+	}
+
+	return func(e *Encoder, v reflect.Value) error {
+		if isIntKind(v.Kind()) {
+			n := v.Int()
+			if signed {
+				return e.encodeFixedInt(n, bits)
+			}
+			if n < 0 {
+				return fmt.Errorf("msgpack: %d overflows uint%d", n, bits)
+			}
+			return e.encodeFixedUint(uint64(n), bits)
+		}
+
+		n := v.Uint()
+		if !signed {
+			return e.encodeFixedUint(n, bits)
+		}
+		if n > math.MaxInt64 {
+			return fmt.Errorf("msgpack: %d overflows int%d", n, bits)
+		}
+		return e.encodeFixedInt(int64(n), bits)
+	}
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
@@ -1,7 +1,12 @@
 package msgpack
 
 import (
+	"fmt"
+	"io"
 	"reflect"
+	"strconv"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/vmihailenco/msgpack/codes"
 )
@@ -19,17 +24,26 @@ func encodeByteArrayValue(e *Encoder, v reflect.Value) error {
 		return err
 	}
 
-	if v.CanAddr() {
-		b := v.Slice(0, v.Len()).Bytes()
-		return e.write(b)
-	}
+	return e.write(byteArrayBytes(v))
+}
 
-	b := make([]byte, v.Len())
-	reflect.Copy(reflect.ValueOf(b), v)
-	return e.write(b)
+func byteArrayBytes(v reflect.Value) []byte {
+	if !v.CanAddr() {
+		// Copy the array to make it addressable. reflect.Copy can't be used
+		// here because element type may be a named byte type.
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		v = cp
+	}
+	return v.Slice(0, v.Len()).Bytes()
 }
 
+// EncodeBytesLen encodes the header of bin with length l
+// that must be followed by l bytes of payload.
 func (e *Encoder) EncodeBytesLen(l int) error {
+	if e.compatibleEncoding {
+		return e.encodeStrLen(l)
+	}
 	if l < 256 {
 		return e.write1(codes.Bin8, uint64(l))
 	}
@@ -43,7 +57,7 @@ func (e *Encoder) encodeStrLen(l int) error {
 	if l < 32 {
 		return e.writeCode(codes.FixedStrLow | codes.Code(l))
 	}
-	if l < 256 {
+	if l < 256 && !e.compatibleEncoding {
 		return e.write1(codes.Str8, uint64(l))
 	}
 	if l < 65536 {
@@ -53,6 +67,9 @@ func (e *Encoder) encodeStrLen(l int) error {
 }
 
 func (e *Encoder) EncodeString(v string) error {
+	if e.validateUTF8 && !utf8.ValidString(v) {
+		return ErrInvalidUTF8
+	}
 	if err := e.encodeStrLen(len(v)); err != nil {
 		return err
 	}
@@ -69,6 +86,26 @@ func (e *Encoder) EncodeBytes(v []byte) error {
 	return e.write(v)
 }
 
+// EncodeBytesFromReader encodes n bytes read from r as MessagePack bin
+// without loading them into memory. It returns io.ErrUnexpectedEOF if r
+// has less than n bytes, in which case the encoded data is incomplete.
+func (e *Encoder) EncodeBytesFromReader(r io.Reader, n int) error {
+	if n < 0 {
+		return fmt.Errorf("msgpack: invalid bytes length %d", n)
+	}
+	if err := e.EncodeBytesLen(n); err != nil {
+		return err
+	}
+	_, err := io.CopyN(e.w, r, int64(n))
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// EncodeArrayLen encodes the header of an array with l elements.
+// It must be followed by exactly l encoded values. Together with
+// EncodeMapLen it allows composing messages without reflection.
 func (e *Encoder) EncodeArrayLen(l int) error {
 	if l < 16 {
 		return e.writeCode(codes.FixedArrayLow | codes.Code(l))
@@ -94,22 +131,50 @@ func (e *Encoder) encodeStringSlice(s []string) error {
 	return nil
 }
 
-func encodeSliceValue(e *Encoder, v reflect.Value) error {
-	if v.IsNil() {
-		return e.EncodeNil()
+// sliceEncoderFunc returns the encoder of slice type typ
+// with the element encoder resolved once.
+func sliceEncoderFunc(typ reflect.Type) encoderFunc {
+	encodeArray := arrayEncoderFunc(typ)
+	return func(e *Encoder, v reflect.Value) error {
+		if v.IsNil() {
+			return e.EncodeNil()
+		}
+		// Empty slices may share the pointer and can't form a cycle.
+		if e.detectCycles && v.Len() > 0 {
+			if err := e.enter(v); err != nil {
+				return err
+			}
+			defer e.leave(v)
+		}
+		return encodeArray(e, v)
 	}
-	return encodeArrayValue(e, v)
 }
 
-func encodeArrayValue(e *Encoder, v reflect.Value) error {
-	l := v.Len()
-	if err := e.EncodeArrayLen(l); err != nil {
-		return err
-	}
-	for i := 0; i < l; i++ {
-		if err := e.EncodeValue(v.Index(i)); err != nil {
+// arrayEncoderFunc returns the encoder of array or slice type typ
+// with the element encoder resolved once.
+func arrayEncoderFunc(typ reflect.Type) encoderFunc {
+	// The element encoder is resolved on first use because
+	// the element type may refer to typ itself.
+	var once sync.Once
+	var encodeElem encoderFunc
+	return func(e *Encoder, v reflect.Value) error {
+		once.Do(func() {
+			encodeElem = getEncoder(typ.Elem())
+		})
+		l := v.Len()
+		if err := e.EncodeArrayLen(l); err != nil {
 			return err
 		}
+		for i := 0; i < l; i++ {
+			if e.detectCycles {
+				e.pushPath(strconv.Itoa(i))
+			}
+			err := encodeElem(e, v.Index(i))
+			e.popPath()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	return nil
 }
@@ -24,21 +24,24 @@ func init() {
 		reflect.Float64:       encodeFloat64Value,
 		reflect.Complex64:     encodeUnsupportedValue,
 		reflect.Complex128:    encodeUnsupportedValue,
-		reflect.Array:         encodeArrayValue,
 		reflect.Chan:          encodeUnsupportedValue,
 		reflect.Func:          encodeUnsupportedValue,
 		reflect.Interface:     encodeInterfaceValue,
 		reflect.Map:           encodeMapValue,
 		reflect.Ptr:           encodeUnsupportedValue,
-		reflect.Slice:         encodeSliceValue,
 		reflect.String:        encodeStringValue,
-		reflect.Struct:        encodeStructValue,
 		reflect.UnsafePointer: encodeUnsupportedValue,
 	}
 }
 
+// getEncoder returns the encoder of typ. Encoders are built once per
+// type and cached until registered types change.
 func getEncoder(typ reflect.Type) encoderFunc {
-	if encoder, ok := typEncMap[typ]; ok {
+	return encoders.Encoder(typ)
+}
+
+func newEncoder(typ reflect.Type) encoderFunc {
+	if encoder, ok := registeredEncoder(typ); ok {
 		return encoder
 	}
 
@@ -73,10 +76,14 @@ func getEncoder(typ reflect.Type) encoderFunc {
 		if typ.Elem().Kind() == reflect.Uint8 {
 			return encodeByteSliceValue
 		}
+		return sliceEncoderFunc(typ)
 	case reflect.Array:
 		if typ.Elem().Kind() == reflect.Uint8 {
 			return encodeByteArrayValue
 		}
+		return arrayEncoderFunc(typ)
+	case reflect.Struct:
+		return structEncoderFunc(typ)
 	case reflect.Map:
 		if typ.Key() == stringType {
 			switch typ.Elem() {
@@ -96,6 +103,17 @@ func ptrEncoderFunc(typ reflect.Type) encoderFunc {
 		if v.IsNil() {
 			return e.EncodeNil()
 		}
+		if e.sharedRefs {
+			return e.encodeSharedRef(v, encoder)
+		}
+		if e.detectCycles {
+			if err := e.enter(v); err != nil {
+				return err
+			}
+			err := encoder(e, v.Elem())
+			e.leave(v)
+			return err
+		}
 		return encoder(e, v.Elem())
 	}
 }
@@ -104,6 +122,9 @@ func encodeCustomValuePtr(e *Encoder, v reflect.Value) error {
 	if !v.CanAddr() {
 		return fmt.Errorf("msgpack: Encode(non-addressable %T)", v.Interface())
 	}
+	if e.encodeSize(v.Addr()) {
+		return nil
+	}
 	encoder := v.Addr().Interface().(CustomEncoder)
 	return encoder.EncodeMsgpack(e)
 }
@@ -116,6 +137,9 @@ func encodeCustomValue(e *Encoder, v reflect.Value) error {
 		}
 	}
 
+	if e.encodeSize(v) {
+		return nil
+	}
 	encoder := v.Interface().(CustomEncoder)
 	return encoder.EncodeMsgpack(e)
 }
@@ -135,6 +159,9 @@ func marshalValue(e *Encoder, v reflect.Value) error {
 		}
 	}
 
+	if e.encodeSize(v) {
+		return nil
+	}
 	marshaler := v.Interface().(Marshaler)
 	b, err := marshaler.MarshalMsgpack()
 	if err != nil {
@@ -152,7 +179,11 @@ func encodeInterfaceValue(e *Encoder, v reflect.Value) error {
 	if v.IsNil() {
 		return e.EncodeNil()
 	}
-	return e.EncodeValue(v.Elem())
+	elem := v.Elem()
+	if name, ok := typeName(elem.Type()); ok {
+		return e.encodeNamedValue(name, elem)
+	}
+	return e.EncodeValue(elem)
 }
 
 func encodeErrorValue(e *Encoder, v reflect.Value) error {
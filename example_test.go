@@ -193,3 +193,45 @@ func ExampleMarshal_omitEmpty() {
 	// Output: item: "\x82\xa3Foo\xa5hello\xa3Bar\xa0"
 	// item2: "\x81\xa3Foo\xa5hello"
 }
+
+func ExampleEncoder_EncodeArrayLen() {
+	// A point is encoded as [x, y, label] without reflection.
+	buf := new(bytes.Buffer)
+	enc := msgpack.NewEncoder(buf)
+	if err := enc.EncodeArrayLen(3); err != nil {
+		panic(err)
+	}
+	if err := enc.EncodeInt(1); err != nil {
+		panic(err)
+	}
+	if err := enc.EncodeInt(2); err != nil {
+		panic(err)
+	}
+	if err := enc.EncodeBytes([]byte("origin")); err != nil {
+		panic(err)
+	}
+
+	dec := msgpack.NewDecoder(buf)
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		panic(err)
+	}
+	x, err := dec.DecodeInt()
+	if err != nil {
+		panic(err)
+	}
+	y, err := dec.DecodeInt()
+	if err != nil {
+		panic(err)
+	}
+	l, err := dec.DecodeBytesLen()
+	if err != nil {
+		panic(err)
+	}
+	label := make([]byte, l)
+	if err := dec.ReadFull(label); err != nil {
+		panic(err)
+	}
+	fmt.Println(n, x, y, string(label))
+	// Output: 3 1 2 origin
+}
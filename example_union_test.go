@@ -0,0 +1,66 @@
+package msgpack_test
+
+import (
+	"fmt"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type AccountOpened struct {
+	Owner string
+}
+
+type MoneyDeposited struct {
+	Amount int
+}
+
+var accountEvents = msgpack.NewUnion().
+	Register("opened", AccountOpened{}).
+	Register("deposited", MoneyDeposited{})
+
+type Event struct {
+	Seq     int
+	Payload interface{}
+}
+
+var _ msgpack.CustomEncoder = (*Event)(nil)
+var _ msgpack.CustomDecoder = (*Event)(nil)
+
+func (ev *Event) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if err := enc.EncodeInt(int64(ev.Seq)); err != nil {
+		return err
+	}
+	return accountEvents.Encode(enc, ev.Payload)
+}
+
+func (ev *Event) DecodeMsgpack(dec *msgpack.Decoder) error {
+	var err error
+	ev.Seq, err = dec.DecodeInt()
+	if err != nil {
+		return err
+	}
+	ev.Payload, err = accountEvents.Decode(dec)
+	return err
+}
+
+func ExampleUnion() {
+	b, err := msgpack.Marshal([]*Event{
+		{Seq: 1, Payload: AccountOpened{Owner: "alice"}},
+		{Seq: 2, Payload: MoneyDeposited{Amount: 100}},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	var events []*Event
+	err = msgpack.Unmarshal(b, &events)
+	if err != nil {
+		panic(err)
+	}
+	for _, ev := range events {
+		fmt.Printf("%d %#v\n", ev.Seq, ev.Payload)
+	}
+
+	// Output: 1 msgpack_test.AccountOpened{Owner:"alice"}
+	// 2 msgpack_test.MoneyDeposited{Amount:100}
+}
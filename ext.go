@@ -23,6 +23,8 @@ var bufferPool = &sync.Pool{
 // transferred as implementations of interface values need to be registered.
 // Expecting to be used only during initialization, it panics if the mapping
 // between types and ids is not a bijection.
+// Byte arrays without custom encoding, e.g. github.com/google/uuid.UUID,
+// are encoded as raw ext payload, i.e. [16]byte is encoded as fixext16.
 func RegisterExt(id int8, value interface{}) {
 	typ := reflect.TypeOf(value)
 	if typ.Kind() == reflect.Ptr {
@@ -30,47 +32,66 @@ func RegisterExt(id int8, value interface{}) {
 	}
 	ptr := reflect.PtrTo(typ)
 
+	ptrEnc := getEncoder(ptr)
+	enc := getEncoder(typ)
+	dec := getDecoder(typ)
+	if reflect.ValueOf(enc).Pointer() == encodeByteArrayValuePtr {
+		enc = encodeExtByteArrayValue
+		ptrEnc = encodeExtByteArrayPtrValue
+		dec = decodeExtByteArrayValue
+	}
+
+	typesMu.Lock()
 	if _, ok := extTypes[id]; ok {
+		typesMu.Unlock()
 		panic(fmt.Errorf("msgpack: ext with id=%d is already registered", id))
 	}
 	extTypes[id] = typ
+	typEncMap[ptr] = makeExtEncoder(id, ptrEnc)
+	typEncMap[typ] = makeExtEncoder(id, enc)
+	typDecMap[typ] = dec
+	typesMu.Unlock()
 
-	registerExt(id, ptr, getEncoder(ptr), nil)
-	registerExt(id, typ, getEncoder(typ), getDecoder(typ))
+	typesChanged()
 }
 
-func registerExt(id int8, typ reflect.Type, enc encoderFunc, dec decoderFunc) {
-	if enc != nil {
-		typEncMap[typ] = makeExtEncoder(id, enc)
-	}
-	if dec != nil {
-		typDecMap[typ] = dec
-	}
+func extType(id int8) (reflect.Type, bool) {
+	typesMu.RLock()
+	typ, ok := extTypes[id]
+	typesMu.RUnlock()
+	return typ, ok
 }
 
 func makeExtEncoder(typeId int8, enc encoderFunc) encoderFunc {
 	return func(e *Encoder, v reflect.Value) error {
-		buf := bufferPool.Get().(*bytes.Buffer)
-		defer bufferPool.Put(buf)
-		buf.Reset()
+		return e.encodeExt(typeId, func(e *Encoder) error {
+			return enc(e, v)
+		})
+	}
+}
 
-		oldw := e.w
-		e.w = buf
-		err := enc(e, v)
-		e.w = oldw
+// encodeExt encodes ext with the body written by enc.
+func (e *Encoder) encodeExt(typeId int8, enc func(*Encoder) error) error {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
 
-		if err != nil {
-			return err
-		}
+	oldw := e.w
+	e.w = buf
+	err := enc(e)
+	e.w = oldw
 
-		if err := e.encodeExtLen(buf.Len()); err != nil {
-			return err
-		}
-		if err := e.w.WriteByte(byte(typeId)); err != nil {
-			return err
-		}
-		return e.write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := e.encodeExtLen(buf.Len()); err != nil {
+		return err
 	}
+	if err := e.w.WriteByte(byte(typeId)); err != nil {
+		return err
+	}
+	return e.write(buf.Bytes())
 }
 
 func (e *Encoder) encodeExtLen(l int) error {
@@ -150,24 +171,113 @@ func (d *Decoder) ext(c codes.Code) (interface{}, error) {
 		return nil, err
 	}
 
-	typ, ok := extTypes[int8(extId)]
+	switch int8(extId) {
+	case timeExtId, zonedTimeExtId:
+		d.extLen = 0
+		return d.time(int8(extId), extLen)
+	case typeNameExtId:
+		d.extLen = 0
+		return d.decodeNamedValue()
+	case sharedDefExtId:
+		d.extLen = 0
+		return d.decodeSharedDefInterface()
+	case sharedRefExtId:
+		d.extLen = 0
+		return d.decodeSharedRefInterface(extLen)
+	case keyDefExtId, keyRefExtId:
+		d.extLen = 0
+		return d.dictKeyExt(int8(extId), extLen)
+	case uuidExtId:
+		d.extLen = 0
+		return d.uuid(extLen)
+	case decimalExtId:
+		d.extLen = 0
+		return d.decimal(extLen)
+	case durationExtId:
+		d.extLen = 0
+		return d.duration(extLen)
+	}
+
+	typ, ok := extType(int8(extId))
 	if !ok {
 		return nil, fmt.Errorf("msgpack: unregistered ext id=%d", extId)
 	}
 
 	v := reflect.New(typ).Elem()
-	if err := d.DecodeValue(v); err != nil {
+	err = d.DecodeValue(v)
+	// Decoders that don't use the saved length leave it set.
+	d.extLen = 0
+	if err != nil {
 		return nil, err
 	}
 
 	return v.Interface(), nil
 }
 
+var encodeByteArrayValuePtr uintptr
+
+func init() {
+	encodeByteArrayValuePtr = reflect.ValueOf(encodeByteArrayValue).Pointer()
+}
+
+// encodeExtByteArrayValue writes byte array as is to be used as ext body.
+func encodeExtByteArrayValue(e *Encoder, v reflect.Value) error {
+	return e.write(byteArrayBytes(v))
+}
+
+func encodeExtByteArrayPtrValue(e *Encoder, v reflect.Value) error {
+	if v.IsNil() {
+		return e.EncodeNil()
+	}
+	return encodeExtByteArrayValue(e, v.Elem())
+}
+
+func decodeExtByteArrayValue(d *Decoder, v reflect.Value) error {
+	n := d.extLen
+	if n == 0 {
+		c, err := d.readCode()
+		if err != nil {
+			return err
+		}
+		if !codes.IsExt(c) {
+			return d.byteArray(c, v)
+		}
+
+		n, err = d.parseExtLen(c)
+		if err != nil {
+			return err
+		}
+		// Skip ext type.
+		if _, err := d.readCode(); err != nil {
+			return err
+		}
+	}
+	d.extLen = 0
+
+	if n != v.Len() {
+		return fmt.Errorf("msgpack: %s len is %d, but ext has %d bytes", v.Type(), v.Len(), n)
+	}
+	return d.readFull(v.Slice(0, n).Bytes())
+}
+
 func (d *Decoder) skipExt(c codes.Code) error {
 	n, err := d.parseExtLen(c)
 	if err != nil {
 		return err
 	}
+	extId, err := d.readCode()
+	if err != nil {
+		return err
+	}
+	if int8(extId) == sharedDefExtId {
+		// Skip the value, so that dictionary keys in it are remembered.
+		return d.Skip()
+	}
+	if int8(extId) == keyDefExtId {
+		// Remember the key for the following references.
+		_, err := d.dictKeyExt(int8(extId), n)
+		return err
+	}
 	return d.skipN(n)
 }
 
@@ -1,8 +1,10 @@
 package msgpack_test
 
 import (
+	"bytes"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/vmihailenco/msgpack"
 	"github.com/vmihailenco/msgpack/codes"
@@ -93,6 +95,28 @@ func TestUnknownExt(t *testing.T) {
 	}
 }
 
+func TestSkipExt(t *testing.T) {
+	b := []byte{
+		byte(codes.FixExt1), 1, 0xaa,
+		byte(codes.Ext8), 2, 1, 0xaa, 0xbb,
+		0x07,
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	for i := 0; i < 2; i++ {
+		if err := dec.Skip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := dec.DecodeInt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Fatalf("got %d, wanted 7", n)
+	}
+}
+
 func TestDecodeExtWithMap(t *testing.T) {
 	type S struct {
 		I int
@@ -114,3 +138,37 @@ func TestDecodeExtWithMap(t *testing.T) {
 		t.Fatalf("got %#v, but wanted %#v", got, wanted)
 	}
 }
+
+func TestExtFollowedByBuiltinExts(t *testing.T) {
+	type S struct {
+		A   interface{}
+		U   msgpack.UUID
+		Dec msgpack.Decimal
+		D   time.Duration
+	}
+
+	u, err := msgpack.ParseUUID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := msgpack.ParseDecimal("1.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := S{A: ExtTest{"world"}, U: u, Dec: dec, D: time.Second}
+
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out S
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.U != u || out.Dec.String() != "1.5" || out.D != time.Second {
+		t.Fatalf("got %#v", out)
+	}
+	if ext, ok := out.A.(ExtTest); !ok || ext.S != "hello world" {
+		t.Fatalf("got %#v", out.A)
+	}
+}
@@ -0,0 +1,95 @@
+package msgpack
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Index provides random access to top-level values stored in
+// an io.ReaderAt, e.g. a large file or a memory-mapped region.
+// It holds the offset of every value, so the Decoder for value N is
+// created without reading preceding values. Index is safe for
+// concurrent use.
+//
+// Values must be encoded independently of each other, i.e. without
+// Encoder.UseKeyDictionary or Encoder.UseSharedRefs spanning values.
+type Index struct {
+	r io.ReaderAt
+	// offsets holds start offsets of values followed by the end offset.
+	offsets []int64
+}
+
+// NewIndex scans size bytes of r and records offsets of values.
+func NewIndex(r io.ReaderAt, size int64) (*Index, error) {
+	cr := &countingReader{r: io.NewSectionReader(r, 0, size)}
+	br := bufio.NewReader(cr)
+	d := NewDecoder(br)
+
+	offsets := []int64{0}
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		}
+		if err := d.Skip(); err != nil {
+			off := offsets[len(offsets)-1]
+			return nil, fmt.Errorf("msgpack: value %d at offset %d: %s", len(offsets)-1, off, err)
+		}
+		offsets = append(offsets, cr.n-int64(br.Buffered()))
+	}
+
+	return &Index{
+		r:       r,
+		offsets: offsets,
+	}, nil
+}
+
+// Len returns the number of values.
+func (x *Index) Len() int {
+	return len(x.offsets) - 1
+}
+
+// Offset returns the offset of value i.
+func (x *Index) Offset(i int) int64 {
+	return x.offsets[i]
+}
+
+// Decoder returns a new Decoder reading value i and values following it.
+// Decoders are independent and can be used concurrently.
+func (x *Index) Decoder(i int) *Decoder {
+	end := x.offsets[len(x.offsets)-1]
+	return NewDecoder(io.NewSectionReader(x.r, x.offsets[i], end-x.offsets[i]))
+}
+
+// Decode decodes value i into v.
+func (x *Index) Decode(i int, v interface{}) error {
+	raw, err := x.Raw(i)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(raw, v)
+}
+
+// Raw returns encoded value i.
+func (x *Index) Raw(i int) (RawMessage, error) {
+	b := make([]byte, x.offsets[i+1]-x.offsets[i])
+	n, err := x.r.ReadAt(b, x.offsets[i])
+	if n == len(b) {
+		return b, nil
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return nil, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	return n, err
+}
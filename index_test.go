@@ -0,0 +1,77 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestIndex(t *testing.T) {
+	type record struct {
+		N    int
+		Data []byte
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for i := 0; i < 1000; i++ {
+		if err := enc.Encode(record{N: i, Data: make([]byte, i%300)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bytes.NewReader(buf.Bytes())
+
+	idx, err := msgpack.NewIndex(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Len() != 1000 {
+		t.Fatalf("got %d values, wanted 1000", idx.Len())
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < idx.Len(); i += 4 {
+				var rec record
+				if err := idx.Decode(i, &rec); err != nil {
+					t.Error(err)
+					return
+				}
+				if rec.N != i || len(rec.Data) != i%300 {
+					t.Errorf("got %d, wanted %d", rec.N, i)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	dec := idx.Decoder(998)
+	var rec record
+	if err := dec.Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.N != 999 {
+		t.Fatalf("got %d, wanted 999", rec.N)
+	}
+}
+
+func TestIndexTruncated(t *testing.T) {
+	b, err := msgpack.Marshal("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = b[:len(b)-1]
+	_, err = msgpack.NewIndex(bytes.NewReader(b), int64(len(b)))
+	if err == nil || err.Error() != "msgpack: value 1 at offset 4: unexpected EOF" {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+//go:build go1.23
+// +build go1.23
+
+package msgpack
+
+import (
+	"iter"
+)
+
+// Elements returns an iterator over raw elements of the next array.
+// Nil is iterated as an empty array. If the loop is exited early the
+// rest of the array is skipped. Iteration stops at the first error
+// which is reported by Err.
+func (d *Decoder) Elements() iter.Seq[RawMessage] {
+	return func(yield func(RawMessage) bool) {
+		d.iterErr = nil
+
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			d.iterErr = err
+			return
+		}
+		for i := 0; i < n; i++ {
+			elem, err := d.readRaw()
+			if err != nil {
+				d.iterErr = err
+				return
+			}
+			if !yield(elem) {
+				d.iterErr = d.skipNext(n - i - 1)
+				return
+			}
+		}
+	}
+}
+
+// Entries returns an iterator over raw keys and values of the next map.
+// Nil is iterated as an empty map. If the loop is exited early the rest
+// of the map is skipped. Iteration stops at the first error which is
+// reported by Err.
+func (d *Decoder) Entries() iter.Seq2[RawMessage, RawMessage] {
+	return func(yield func(RawMessage, RawMessage) bool) {
+		d.iterErr = nil
+
+		n, err := d.DecodeMapLen()
+		if err != nil {
+			d.iterErr = err
+			return
+		}
+		for i := 0; i < n; i++ {
+			key, err := d.readRaw()
+			if err != nil {
+				d.iterErr = err
+				return
+			}
+			value, err := d.readRaw()
+			if err != nil {
+				d.iterErr = err
+				return
+			}
+			if !yield(key, value) {
+				d.iterErr = d.skipNext(2 * (n - i - 1))
+				return
+			}
+		}
+	}
+}
+
+// Err returns the error that stopped the last iteration
+// over Elements or Entries.
+func (d *Decoder) Err() error {
+	return d.iterErr
+}
@@ -0,0 +1,81 @@
+//go:build go1.23
+// +build go1.23
+
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestElements(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.Encode([]interface{}{"a", 1, []int{2, 3}}, "next"); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(&buf)
+	var got []interface{}
+	for elem := range dec.Elements() {
+		var v interface{}
+		if err := msgpack.Unmarshal(elem, &v); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+		if len(got) == 2 {
+			break
+		}
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != int64(1) {
+		t.Fatalf("got %v", got)
+	}
+
+	// The rest of the array is skipped.
+	s, err := dec.DecodeString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "next" {
+		t.Fatalf("got %q, wanted next", s)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]int{"a": 1, "b": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	got := make(map[string]int)
+	for key, value := range dec.Entries() {
+		var k string
+		var v int
+		if err := msgpack.Unmarshal(key, &k); err != nil {
+			t.Fatal(err)
+		}
+		if err := msgpack.Unmarshal(value, &v); err != nil {
+			t.Fatal(err)
+		}
+		got[k] = v
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["a"] != 1 || got["b"] != 2 {
+		t.Fatalf("got %v", got)
+	}
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b[:len(b)-1]))
+	for range dec.Entries() {
+	}
+	if dec.Err() == nil {
+		t.Fatal("got nil error, wanted unexpected EOF")
+	}
+}
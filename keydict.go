@@ -0,0 +1,140 @@
+package msgpack
+
+import (
+	"fmt"
+	"io/ioutil"
+	"unicode/utf8"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// Ext ids used by the key dictionary. The first occurrence of a map key
+// is encoded as a definition, i.e. ext with the key bytes, and the following
+// occurrences as a reference, i.e. fixext1 or fixext2 with the index
+// of the definition.
+var keyDefExtId int8 = -121
+var keyRefExtId int8 = -120
+
+const maxDictKeys = 1 << 16
+
+// UseKeyDictionary causes the Encoder to encode each string map key
+// and struct field name only once and to encode repeated keys as indexes,
+// which shrinks homogeneous payloads like arrays of structs. Keys are
+// remembered across all values encoded by the Encoder, so the values must be
+// decoded in the same order by a single Decoder. Decoder decodes such keys
+// transparently. Enabling the option resets remembered keys.
+func (e *Encoder) UseKeyDictionary(v bool) *Encoder {
+	e.keyDict = v
+	e.keys = nil
+	return e
+}
+
+func (e *Encoder) encodeMapKey(s string) error {
+	if !e.keyDict {
+		return e.EncodeString(s)
+	}
+
+	if idx, ok := e.keys[s]; ok {
+		if idx < 256 {
+			if err := e.writeCode(codes.FixExt1); err != nil {
+				return err
+			}
+			return e.write1(codes.Code(keyRefExtId), uint64(idx))
+		}
+		if err := e.writeCode(codes.FixExt2); err != nil {
+			return err
+		}
+		return e.write2(codes.Code(keyRefExtId), uint64(idx))
+	}
+
+	if len(e.keys) >= maxDictKeys {
+		return e.EncodeString(s)
+	}
+	if e.validateUTF8 && !utf8.ValidString(s) {
+		return ErrInvalidUTF8
+	}
+	if e.keys == nil {
+		e.keys = make(map[string]int)
+	}
+	e.keys[s] = len(e.keys)
+
+	if err := e.encodeExtLen(len(s)); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(byte(keyDefExtId)); err != nil {
+		return err
+	}
+	return e.writeString(s)
+}
+
+func (d *Decoder) dictKey(c codes.Code) (string, error) {
+	n, err := d.parseExtLen(c)
+	if err != nil {
+		return "", err
+	}
+	extId, err := d.readCode()
+	if err != nil {
+		return "", err
+	}
+	return d.dictKeyExt(int8(extId), n)
+}
+
+// dictKeyExt decodes key definition or reference. The ext header
+// is already read.
+func (d *Decoder) dictKeyExt(extId int8, extLen int) (string, error) {
+	switch extId {
+	case keyDefExtId:
+		// The Encoder never defines more keys, so more definitions
+		// would only grow the dictionary of a long-lived Decoder.
+		if len(d.keys) >= maxDictKeys {
+			return "", fmt.Errorf("msgpack: key dictionary has more than %d keys", maxDictKeys)
+		}
+		b, err := d.readN(extLen)
+		if err != nil {
+			return "", err
+		}
+		if d.validateUTF8 && !utf8.Valid(b) {
+			return "", ErrInvalidUTF8
+		}
+		s := string(b)
+		d.keys = append(d.keys, s)
+		return s, nil
+	case keyRefExtId:
+		var idx int
+		switch extLen {
+		case 1:
+			n, err := d.uint8()
+			if err != nil {
+				return "", err
+			}
+			idx = int(n)
+		case 2:
+			n, err := d.uint16()
+			if err != nil {
+				return "", err
+			}
+			idx = int(n)
+		default:
+			return "", fmt.Errorf("msgpack: invalid ext len=%d decoding key ref", extLen)
+		}
+		if idx >= len(d.keys) {
+			return "", fmt.Errorf("msgpack: invalid key ref=%d", idx)
+		}
+		return d.keys[idx], nil
+	}
+	if _, err := d.copyN(ioutil.Discard, int64(extLen)); err != nil {
+		return "", err
+	}
+	return "", &ExtKeyError{ExtId: extId}
+}
+
+// ExtKeyError is returned when a string is decoded from an ext that
+// is not a key dictionary entry. The ext is skipped, so decoding can
+// continue with the next value.
+type ExtKeyError struct {
+	ExtId int8
+}
+
+func (e *ExtKeyError) Error() string {
+	return fmt.Sprintf("msgpack: invalid ext id=%d decoding string", e.ExtId)
+}
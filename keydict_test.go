@@ -0,0 +1,96 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type keyDictItem struct {
+	Name  string
+	Count int
+	Attrs map[string]int
+}
+
+func TestKeyDictionary(t *testing.T) {
+	var in []keyDictItem
+	for i := 0; i < 300; i++ {
+		in = append(in, keyDictItem{
+			Name:  "item",
+			Count: i,
+			Attrs: map[string]int{string(rune('a' + i%26)): i, "count": i},
+		})
+	}
+
+	plain, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf).UseKeyDictionary(true)
+	if err := enc.Encode(in, map[string]interface{}{"Name": "last"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= len(plain) {
+		t.Fatalf("got %d bytes, wanted less than %d", buf.Len(), len(plain))
+	}
+	b := buf.Bytes()
+
+	var out []keyDictItem
+	var last map[string]interface{}
+	if err := msgpack.Unmarshal(b, &out, &last); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got %v, wanted %v", out, in)
+	}
+	if last["Name"] != "last" {
+		t.Fatalf("got %v, wanted Name=last", last)
+	}
+
+	var iface []interface{}
+	if _, err := msgpack.UnmarshalPrefix(b, &iface); err != nil {
+		t.Fatal(err)
+	}
+	if m := iface[299].(map[string]interface{}); m["Name"] != "item" {
+		t.Fatalf("got %v", m)
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	if err := dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&last); err != nil {
+		t.Fatal(err)
+	}
+	if last["Name"] != "last" {
+		t.Fatalf("got %v, wanted Name=last", last)
+	}
+
+	values, err := msgpack.NewDecoder(bytes.NewReader(b)).Query("*.Attrs.count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 300 {
+		t.Fatalf("got %d values, wanted 300", len(values))
+	}
+}
+
+func TestKeyDictionaryLimit(t *testing.T) {
+	const n = 1<<16 + 1
+	b := []byte{0xdf, 0x00, 0x01, 0x00, 0x01}
+	for i := 0; i < n; i++ {
+		// Key definition of "k" with nil value.
+		b = append(b, 0xc7, 0x01, 0x87, 'k', 0xc0)
+	}
+
+	var out interface{}
+	err := msgpack.Unmarshal(b, &out)
+	wanted := "msgpack: key dictionary has more than 65536 keys"
+	if err == nil || err.Error() != wanted {
+		t.Fatalf("got %v, wanted %q", err, wanted)
+	}
+}
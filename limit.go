@@ -0,0 +1,100 @@
+package msgpack
+
+import "errors"
+
+// ErrLimitExceeded is returned by Decoder when a value is larger
+// than the limit set with SetMaxMessageSize.
+var ErrLimitExceeded = errors.New("msgpack: message size limit exceeded")
+
+// SetMaxMessageSize limits the number of bytes the Decoder consumes
+// decoding a single value passed to Decode. Bytes consumed by other
+// decoding methods count towards the limit until the next call of Decode.
+// Array, map, string and binary lengths that can't fit into the remaining
+// bytes are rejected before anything is allocated for them, which also
+// bounds the number of decoded elements. Zero or negative n disables
+// the limit.
+func (d *Decoder) SetMaxMessageSize(n int) {
+	d.maxSize = int64(n)
+	d.size = 0
+	d.wrapReader()
+}
+
+// wrapReader wraps the reader in sizeLimiter if the size limit
+// or stats are enabled.
+func (d *Decoder) wrapReader() {
+	if l, ok := d.r.(*sizeLimiter); ok {
+		d.r = l.r
+	}
+	if d.maxSize > 0 || d.stats != nil {
+		d.r = &sizeLimiter{r: d.r, d: d}
+	}
+}
+
+// checkLen returns ErrLimitExceeded if n elements taking at least
+// elemSize bytes each can't fit into the remaining message size.
+func (d *Decoder) checkLen(n int, elemSize int64) error {
+	if d.maxSize > 0 && int64(n)*elemSize > d.maxSize-d.size {
+		return ErrLimitExceeded
+	}
+	return nil
+}
+
+// sizeLimiter counts bytes read by the Decoder and enforces
+// the size limit if it is set.
+type sizeLimiter struct {
+	r bufReader
+	d *Decoder
+}
+
+func (l *sizeLimiter) Read(b []byte) (int, error) {
+	if l.d.maxSize > 0 {
+		rem := l.d.maxSize - l.d.size
+		if rem <= 0 {
+			return 0, ErrLimitExceeded
+		}
+		if int64(len(b)) > rem {
+			b = b[:rem]
+		}
+	}
+	n, err := l.r.Read(b)
+	l.d.size += int64(n)
+	if l.d.stats != nil {
+		l.d.stats.bytes(b[:n])
+	}
+	return n, err
+}
+
+func (l *sizeLimiter) ReadByte() (byte, error) {
+	if l.d.maxSize > 0 && l.d.size >= l.d.maxSize {
+		return 0, ErrLimitExceeded
+	}
+	c, err := l.r.ReadByte()
+	if err == nil {
+		l.d.size++
+		if l.d.stats != nil {
+			l.d.stats.byte(c)
+		}
+	}
+	return c, err
+}
+
+func (l *sizeLimiter) UnreadByte() error {
+	if err := l.r.UnreadByte(); err != nil {
+		return err
+	}
+	l.d.size--
+	if l.d.stats != nil {
+		l.d.stats.stats.Bytes--
+	}
+	return nil
+}
+
+func (l *sizeLimiter) Peek(n int) ([]byte, error) {
+	// The reader is wrapped with bufio.Reader by ensurePeeker
+	// before Peek is used.
+	p, ok := l.r.(peeker)
+	if !ok {
+		return nil, errNoPeeker
+	}
+	return p.Peek(n)
+}
@@ -0,0 +1,139 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestMaxMessageSize(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.Encode("hello", []int{1, 2, 3}, "world"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit applies to each value separately.
+	dec := msgpack.NewDecoder(bytes.NewReader(buf.Bytes()))
+	dec.SetMaxMessageSize(6)
+	var s1, s2 string
+	var ints []int
+	if err := dec.Decode(&s1, &ints, &s2); err != nil {
+		t.Fatal(err)
+	}
+	if s1 != "hello" || len(ints) != 3 || s2 != "world" {
+		t.Fatalf("got %q %v %q", s1, ints, s2)
+	}
+
+	b, err := msgpack.Marshal(map[string]string{"key": strings.Repeat("x", 100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetMaxMessageSize(50)
+	var m map[string]string
+	if err := dec.Decode(&m); err != msgpack.ErrLimitExceeded {
+		t.Fatalf("got %v, wanted ErrLimitExceeded", err)
+	}
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetMaxMessageSize(len(b))
+	if err := dec.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxMessageSizeLargeHeader(t *testing.T) {
+	// array32 header claiming 1 billion elements.
+	b := []byte{0xdd, 0x40, 0x00, 0x00, 0x00, 0x01, 0x02}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetMaxMessageSize(1024)
+	var v interface{}
+	if err := dec.Decode(&v); err != msgpack.ErrLimitExceeded {
+		t.Fatalf("got %v, wanted ErrLimitExceeded", err)
+	}
+
+	// map32 header claiming 1 billion entries.
+	b = []byte{0xdf, 0x40, 0x00, 0x00, 0x00}
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetMaxMessageSize(1024)
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != msgpack.ErrLimitExceeded {
+		t.Fatalf("got %v, wanted ErrLimitExceeded", err)
+	}
+}
+
+func TestMaxMessageSizeSharedRefs(t *testing.T) {
+	type node struct {
+		Name string
+		Next *node
+	}
+	n := &node{Name: "a"}
+	n.Next = &node{Name: "b", Next: n}
+
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).UseSharedRefs(true).Encode(n); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(&buf)
+	dec.SetMaxMessageSize(100)
+	dec.UseSharedRefs(true)
+	var out *node
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Next.Next != out {
+		t.Fatal("pointer identity is not preserved")
+	}
+}
+
+type nestedStrings struct {
+	S []string
+}
+
+var _ msgpack.CustomDecoder = (*nestedStrings)(nil)
+
+func (n *nestedStrings) DecodeMsgpack(d *msgpack.Decoder) error {
+	l, err := d.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	n.S = make([]string, l)
+	for i := range n.S {
+		if err := d.Decode(&n.S[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMaxMessageSizeCustomDecoder(t *testing.T) {
+	in := make([]string, 100)
+	for i := range in {
+		in[i] = "0123456789"
+	}
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetMaxMessageSize(200)
+	var out nestedStrings
+	if err := dec.Decode(&out); err != msgpack.ErrLimitExceeded {
+		t.Fatalf("got %v, wanted ErrLimitExceeded", err)
+	}
+
+	dec = msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetMaxMessageSize(len(b))
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.S) != 100 {
+		t.Fatalf("got %d strings, wanted 100", len(out.S))
+	}
+}
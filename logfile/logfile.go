@@ -0,0 +1,234 @@
+// Package logfile implements an append-only log of msgpack records,
+// e.g. for write-ahead logs and event logs.
+//
+// Each record is stored as a 4-byte big-endian payload length,
+// a 4-byte big-endian CRC-32 (Castagnoli) of the payload and the
+// msgpack-encoded payload. A torn or corrupted record ends the log:
+// Reader reports it with ErrCorrupt and Open truncates the file
+// before appending new records.
+package logfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+const headerLen = 8
+
+// maxRecordLen is the largest accepted payload. Larger lengths
+// are considered corruption.
+const maxRecordLen = 1 << 30
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned by Reader when a record is incomplete
+// or its checksum does not match.
+var ErrCorrupt = errors.New("logfile: corrupt record")
+
+// Writer appends records to a log.
+type Writer struct {
+	w   io.Writer
+	f   *os.File
+	buf bytes.Buffer
+	enc *msgpack.Encoder
+	off int64
+	err error
+}
+
+// NewWriter returns a Writer appending records to w.
+func NewWriter(w io.Writer) *Writer {
+	wr := &Writer{w: w}
+	wr.enc = msgpack.NewEncoder(&wr.buf)
+	return wr
+}
+
+// Open opens the log file at path for appending, creating it if needed.
+// Records following the first corrupted record, including the corrupted
+// one, are truncated.
+func Open(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewReader(f)
+	for {
+		err := r.Next(nil)
+		if err == io.EOF || err == ErrCorrupt {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	off := r.Offset()
+	if err := f.Truncate(off); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w := NewWriter(f)
+	w.f = f
+	w.off = off
+	return w, nil
+}
+
+// Append encodes v and appends it as a record. The record is written
+// with a single Write call. It returns the offset of the record.
+//
+// If the write fails after a part of the record was written, a Writer
+// created with Open truncates the file back to the record offset.
+// Otherwise the log is left torn and later calls return the write error.
+func (w *Writer) Append(v interface{}) (int64, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf.Reset()
+	w.buf.Write(make([]byte, headerLen))
+	if err := w.enc.Encode(v); err != nil {
+		return 0, err
+	}
+
+	b := w.buf.Bytes()
+	payload := b[headerLen:]
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.Checksum(payload, crcTable))
+
+	off := w.off
+	n, err := w.w.Write(b)
+	if err != nil {
+		if n > 0 && !w.rewind(off) {
+			w.err = err
+		}
+		return 0, err
+	}
+	w.off += int64(n)
+	return off, nil
+}
+
+// rewind drops the bytes written after off.
+func (w *Writer) rewind(off int64) bool {
+	if w.f == nil {
+		return false
+	}
+	if err := w.f.Truncate(off); err != nil {
+		return false
+	}
+	_, err := w.f.Seek(off, io.SeekStart)
+	return err == nil
+}
+
+// Offset returns the size of the log.
+func (w *Writer) Offset() int64 {
+	return w.off
+}
+
+// Sync commits written records to stable storage
+// if the Writer was created with Open.
+func (w *Writer) Sync() error {
+	if w.f == nil {
+		return nil
+	}
+	return w.f.Sync()
+}
+
+// Close closes the file if the Writer was created with Open.
+func (w *Writer) Close() error {
+	if w.f == nil {
+		return nil
+	}
+	return w.f.Close()
+}
+
+// Reader replays records of a log sequentially.
+type Reader struct {
+	r   *bufio.Reader
+	buf bytes.Buffer
+	off int64
+}
+
+// NewReader returns a Reader reading records from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Next decodes the next record into v. Nil v skips the record.
+// It returns io.EOF at the end of the log and ErrCorrupt if the record
+// is incomplete or damaged, in which case the log should be truncated
+// to Offset.
+func (r *Reader) Next(v interface{}) error {
+	payload, err := r.next()
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	return msgpack.Unmarshal(payload, v)
+}
+
+// NextRaw returns the encoded payload of the next record. The payload
+// is valid until the next call of the Reader.
+func (r *Reader) NextRaw() (msgpack.RawMessage, error) {
+	return r.next()
+}
+
+// Offset returns the offset just past the last valid record.
+func (r *Reader) Offset() int64 {
+	return r.off
+}
+
+func (r *Reader) next() ([]byte, error) {
+	var header [headerLen]byte
+	n, err := io.ReadFull(r.r, header[:])
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return nil, ErrCorrupt
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Encoded values are never empty, so a zero size is a zeroed
+	// region, e.g. a preallocated or partially flushed tail.
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size == 0 || size > maxRecordLen {
+		return nil, ErrCorrupt
+	}
+
+	// Copying grows the buffer as data arrives, so a damaged length
+	// does not cause a large allocation.
+	r.buf.Reset()
+	m, err := io.CopyN(&r.buf, r.r, int64(size))
+	if err == io.EOF {
+		return nil, ErrCorrupt
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payload := r.buf.Bytes()
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrCorrupt
+	}
+	r.off += int64(n) + m
+	return payload, nil
+}
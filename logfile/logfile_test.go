@@ -0,0 +1,186 @@
+package logfile_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/logfile"
+)
+
+type event struct {
+	Seq  int
+	Name string
+}
+
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	w := logfile.NewWriter(&buf)
+	for i := 0; i < 3; i++ {
+		if _, err := w.Append(event{Seq: i, Name: "created"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := logfile.NewReader(bytes.NewReader(buf.Bytes()))
+	for i := 0; i < 3; i++ {
+		var ev event
+		if err := r.Next(&ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Seq != i || ev.Name != "created" {
+			t.Fatalf("got %+v", ev)
+		}
+	}
+	if err := r.Next(nil); err != io.EOF {
+		t.Fatalf("got %v, wanted io.EOF", err)
+	}
+	if r.Offset() != int64(buf.Len()) {
+		t.Fatalf("got offset %d, wanted %d", r.Offset(), buf.Len())
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	w := logfile.NewWriter(&buf)
+	if _, err := w.Append(event{Seq: 1}); err != nil {
+		t.Fatal(err)
+	}
+	off, err := w.Append(event{Seq: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := buf.Bytes()
+	b[len(b)-1] ^= 0xff
+
+	r := logfile.NewReader(bytes.NewReader(b))
+	if err := r.Next(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(nil); err != logfile.ErrCorrupt {
+		t.Fatalf("got %v, wanted ErrCorrupt", err)
+	}
+	if r.Offset() != off {
+		t.Fatalf("got offset %d, wanted %d", r.Offset(), off)
+	}
+
+	// Torn header.
+	r = logfile.NewReader(bytes.NewReader(b[:off+3]))
+	if err := r.Next(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(nil); err != logfile.ErrCorrupt {
+		t.Fatalf("got %v, wanted ErrCorrupt", err)
+	}
+
+	// Zeroed tail.
+	zeroed := append(b[:off:off], make([]byte, 16)...)
+	r = logfile.NewReader(bytes.NewReader(zeroed))
+	if err := r.Next(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(nil); err != logfile.ErrCorrupt {
+		t.Fatalf("got %v, wanted ErrCorrupt", err)
+	}
+	if r.Offset() != off {
+		t.Fatalf("got offset %d, wanted %d", r.Offset(), off)
+	}
+}
+
+type shortWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (w *shortWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		w.buf.Write(b[:w.n])
+		return w.n, io.ErrShortWrite
+	}
+	w.n -= len(b)
+	return w.buf.Write(b)
+}
+
+func TestShortWrite(t *testing.T) {
+	sw := &shortWriter{n: 12}
+	w := logfile.NewWriter(sw)
+	if _, err := w.Append(event{Seq: 1}); err != io.ErrShortWrite {
+		t.Fatalf("got %v, wanted io.ErrShortWrite", err)
+	}
+
+	// The log is torn, so later records must not be appended after it.
+	sw.n = 1 << 10
+	if _, err := w.Append(event{Seq: 2}); err != io.ErrShortWrite {
+		t.Fatalf("got %v, wanted io.ErrShortWrite", err)
+	}
+	if sw.buf.Len() != 12 {
+		t.Fatalf("got %d bytes written, wanted 12", sw.buf.Len())
+	}
+}
+
+func TestOpenTruncatesTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.log")
+
+	w, err := logfile.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := w.Append(event{Seq: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte{0, 0, 0, 10, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	w, err = logfile.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Append(event{Seq: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := logfile.NewReader(f)
+	for i := 0; i < 3; i++ {
+		var ev event
+		if err := r.Next(&ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Seq != i {
+			t.Fatalf("got %d, wanted %d", ev.Seq, i)
+		}
+	}
+	if err := r.Next(nil); err != io.EOF {
+		t.Fatalf("got %v, wanted io.EOF", err)
+	}
+}
@@ -0,0 +1,216 @@
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// Merge applies patch to base using JSON merge patch semantics (RFC 7386)
+// and returns MessagePack encoding of the result:
+//   - nil values in the patch delete corresponding keys,
+//   - maps are merged recursively,
+//   - any other patch value replaces the base value.
+//
+// Both base and patch are MessagePack encoded values. Keys are compared
+// by value, so the same string encoded as fixstr and str8 or the same
+// integer encoded as fixint and uint8 is the same key.
+// Merged maps keep the order of keys in base followed by new keys in patch.
+// Repeated keys in base are merged into one with the last value.
+func Merge(base, patch []byte) ([]byte, error) {
+	if !isRawMap(patch) {
+		return patch, nil
+	}
+
+	entries, err := decodeRawMap(base)
+	if err != nil {
+		return nil, err
+	}
+	patchEntries, err := decodeRawMap(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Repeated keys are collapsed and the last value wins, as in JSON.
+	index := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		if j, ok := index[entry.id]; ok {
+			entries[j].value = entry.value
+			entries[i].deleted = true
+			continue
+		}
+		index[entry.id] = i
+	}
+
+	for _, pe := range patchEntries {
+		i, ok := index[pe.id]
+
+		if isRawNil(pe.value) {
+			if ok {
+				entries[i].deleted = true
+				delete(index, pe.id)
+			}
+			continue
+		}
+
+		value := pe.value
+		if isRawMap(value) {
+			var old []byte
+			if ok {
+				old = entries[i].value
+			}
+			value, err = Merge(old, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if ok {
+			entries[i].value = value
+		} else {
+			index[pe.id] = len(entries)
+			entries = append(entries, rawMapEntry{
+				id:    pe.id,
+				key:   pe.key,
+				value: value,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.EncodeMapLen(len(index)); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.deleted {
+			continue
+		}
+		if err := enc.write(entry.key); err != nil {
+			return nil, err
+		}
+		if err := enc.write(entry.value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+type rawMapEntry struct {
+	id      string
+	key     []byte
+	value   []byte
+	deleted bool
+}
+
+func isRawNil(b []byte) bool {
+	return len(b) > 0 && codes.Code(b[0]) == codes.Nil
+}
+
+func isRawMap(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	c := codes.Code(b[0])
+	return codes.IsFixedMap(c) || c == codes.Map16 || c == codes.Map32
+}
+
+func isRawString(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	c := codes.Code(b[0])
+	return codes.IsFixedString(c) || c == codes.Str8 || c == codes.Str16 || c == codes.Str32
+}
+
+func isRawUint(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	c := codes.Code(b[0])
+	return c <= codes.PosFixedNumHigh ||
+		c == codes.Uint8 || c == codes.Uint16 || c == codes.Uint32 || c == codes.Uint64
+}
+
+func isRawInt(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	c := codes.Code(b[0])
+	return c >= codes.NegFixedNumLow ||
+		c == codes.Int8 || c == codes.Int16 || c == codes.Int32 || c == codes.Int64
+}
+
+// decodeRawMap returns undecoded entries of the map encoded in b.
+// Values other than maps are treated as empty maps.
+func decodeRawMap(b []byte) ([]rawMapEntry, error) {
+	if !isRawMap(b) {
+		return nil, nil
+	}
+
+	d := NewDecoder(bytes.NewReader(b))
+	n, err := d.DecodeMapLen()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]rawMapEntry, 0, min(n, mapElemsAllocLimit))
+	for i := 0; i < n; i++ {
+		key, err := d.readRaw()
+		if err != nil {
+			return nil, err
+		}
+		id, err := rawKeyId(key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.readRaw()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, rawMapEntry{
+			id:    id,
+			key:   key,
+			value: value,
+		})
+	}
+	return entries, nil
+}
+
+// rawKeyId returns canonical encoding of the map key.
+// Strings and integers are re-encoded in the most compact form.
+func rawKeyId(key []byte) (string, error) {
+	d := NewDecoder(bytes.NewReader(key))
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+
+	switch {
+	case isRawString(key):
+		s, err := d.DecodeString()
+		if err != nil {
+			return "", err
+		}
+		if err := e.EncodeString(s); err != nil {
+			return "", err
+		}
+	case isRawUint(key):
+		n, err := d.DecodeUint64()
+		if err != nil {
+			return "", err
+		}
+		if err := e.EncodeUint(n); err != nil {
+			return "", err
+		}
+	case isRawInt(key):
+		n, err := d.DecodeInt64()
+		if err != nil {
+			return "", err
+		}
+		if err := e.EncodeInt(n); err != nil {
+			return "", err
+		}
+	default:
+		return string(key), nil
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,140 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func mustMarshalSorted(t *testing.T, v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).SortMapKeys(true).Encode(v); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type mergeTest struct {
+	base, patch, wanted interface{}
+}
+
+var mergeTests = []mergeTest{
+	{
+		base:   map[string]interface{}{"a": "b"},
+		patch:  map[string]interface{}{"a": "c"},
+		wanted: map[string]interface{}{"a": "c"},
+	},
+	{
+		base:   map[string]interface{}{"a": "b"},
+		patch:  map[string]interface{}{"b": "c"},
+		wanted: map[string]interface{}{"a": "b", "b": "c"},
+	},
+	{
+		base:   map[string]interface{}{"a": "b", "b": "c"},
+		patch:  map[string]interface{}{"a": nil},
+		wanted: map[string]interface{}{"b": "c"},
+	},
+	{
+		base:   map[string]interface{}{"a": []interface{}{"b"}},
+		patch:  map[string]interface{}{"a": "c"},
+		wanted: map[string]interface{}{"a": "c"},
+	},
+	{
+		base:   map[string]interface{}{"a": "c"},
+		patch:  map[string]interface{}{"a": []interface{}{"b"}},
+		wanted: map[string]interface{}{"a": []interface{}{"b"}},
+	},
+	{
+		base: map[string]interface{}{
+			"a": map[string]interface{}{"b": "c", "d": "e"},
+		},
+		patch: map[string]interface{}{
+			"a": map[string]interface{}{"b": "d", "d": nil},
+		},
+		wanted: map[string]interface{}{
+			"a": map[string]interface{}{"b": "d"},
+		},
+	},
+	{
+		base:   map[string]interface{}{"a": "b"},
+		patch:  []interface{}{"c"},
+		wanted: []interface{}{"c"},
+	},
+	{
+		base:   map[string]interface{}{"a": "foo"},
+		patch:  nil,
+		wanted: nil,
+	},
+	{
+		base:   "foo",
+		patch:  map[string]interface{}{"a": map[string]interface{}{"b": nil, "c": int64(1)}},
+		wanted: map[string]interface{}{"a": map[string]interface{}{"c": int64(1)}},
+	},
+}
+
+func TestMerge(t *testing.T) {
+	for i, test := range mergeTests {
+		b, err := msgpack.Merge(
+			mustMarshalSorted(t, test.base),
+			mustMarshalSorted(t, test.patch),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got interface{}
+		if err := msgpack.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.wanted) {
+			t.Fatalf("#%d: got %#v, wanted %#v", i, got, test.wanted)
+		}
+	}
+}
+
+func TestMergeKeepsKeyOrder(t *testing.T) {
+	base := mustMarshalSorted(t, map[string]interface{}{"a": 1, "b": 2, "c": 3})
+	patch := mustMarshalSorted(t, map[string]interface{}{"0": 0, "b": nil})
+
+	b, err := msgpack.Merge(base, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := []byte{0x83, 0xa1, 'a', 0x01, 0xa1, 'c', 0x03, 0xa1, '0', 0x00}
+	if !bytes.Equal(b, wanted) {
+		t.Fatalf("got %x, wanted %x", b, wanted)
+	}
+}
+
+func TestMergeIntKeys(t *testing.T) {
+	base := []byte{0x81, 0x01, 0xa1, 'a'}
+	patch := []byte{0x82, 0xcc, 0x01, 0xa1, 'b', 0xd0, 0xff, 0xc0}
+
+	b, err := msgpack.Merge(base, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := []byte{0x81, 0x01, 0xa1, 'b'}
+	if !bytes.Equal(b, wanted) {
+		t.Fatalf("got %x, wanted %x", b, wanted)
+	}
+}
+
+func TestMergeRepeatedKeys(t *testing.T) {
+	base := []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'a', 0x02}
+	patch := []byte{0x81, 0xa1, 'b', 0x03}
+
+	b, err := msgpack.Merge(base, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wanted := []byte{0x82, 0xa1, 'a', 0x02, 0xa1, 'b', 0x03}
+	if !bytes.Equal(b, wanted) {
+		t.Fatalf("got %x, wanted %x", b, wanted)
+	}
+}
@@ -0,0 +1,134 @@
+package msgpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+var nilMessage = []byte{byte(codes.Nil)}
+
+// Message holds an encoded MessagePack value that is decoded lazily.
+// It implements io.WriterTo, io.ReaderFrom, encoding.BinaryMarshaler
+// and encoding.BinaryUnmarshaler, so messages can be passed to APIs
+// working with those interfaces. The zero Message holds nil.
+// Message is not safe for concurrent use.
+type Message struct {
+	raw []byte
+
+	value   interface{}
+	decoded bool
+}
+
+var _ io.WriterTo = (*Message)(nil)
+var _ io.ReaderFrom = (*Message)(nil)
+var _ CustomEncoder = (*Message)(nil)
+var _ CustomDecoder = (*Message)(nil)
+
+// NewMessage returns a Message holding the encoding of v.
+func NewMessage(v interface{}) (*Message, error) {
+	b, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{raw: b}, nil
+}
+
+// Bytes returns the encoded value. The slice must not be modified.
+func (m *Message) Bytes() []byte {
+	if len(m.raw) == 0 {
+		return nilMessage
+	}
+	return m.raw
+}
+
+// Value decodes the message into interface{} on first use
+// and returns the result.
+func (m *Message) Value() (interface{}, error) {
+	if !m.decoded {
+		var v interface{}
+		if err := Unmarshal(m.Bytes(), &v); err != nil {
+			return nil, err
+		}
+		m.value = v
+		m.decoded = true
+	}
+	return m.value, nil
+}
+
+// Decode decodes the message into v.
+func (m *Message) Decode(v interface{}) error {
+	return Unmarshal(m.Bytes(), v)
+}
+
+// WriteTo writes the encoded value to w.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m.Bytes())
+	return int64(n), err
+}
+
+// ReadFrom reads data from r until EOF and stores it in the message.
+// The data must hold exactly one value.
+func (m *Message) ReadFrom(r io.Reader) (int64, error) {
+	var buf bytes.Buffer
+	n, err := buf.ReadFrom(r)
+	if err != nil {
+		return n, err
+	}
+	return n, m.set(buf.Bytes())
+}
+
+// MarshalBinary returns a copy of the encoded value.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), m.Bytes()...), nil
+}
+
+// UnmarshalBinary stores a copy of data that must hold exactly one value.
+func (m *Message) UnmarshalBinary(data []byte) error {
+	return m.set(append([]byte(nil), data...))
+}
+
+func (m *Message) EncodeMsgpack(e *Encoder) error {
+	return e.write(m.Bytes())
+}
+
+func (m *Message) DecodeMsgpack(d *Decoder) error {
+	b, err := d.readRaw()
+	if err != nil {
+		return err
+	}
+	m.reset(b)
+	return nil
+}
+
+func (m *Message) set(b []byte) error {
+	if err := checkOneValue(b); err != nil {
+		return err
+	}
+	m.reset(b)
+	return nil
+}
+
+func (m *Message) reset(b []byte) {
+	m.raw = b
+	m.value = nil
+	m.decoded = false
+}
+
+// checkOneValue returns an error unless b holds exactly one complete value.
+func checkOneValue(b []byte) error {
+	d := PushDecoder{buf: b, pending: 1}
+	complete, err := d.scan()
+	if err != nil {
+		return err
+	}
+	if !complete {
+		return io.ErrUnexpectedEOF
+	}
+	if d.pos != len(b) {
+		return fmt.Errorf("msgpack: %d bytes remain after the value", len(b)-d.pos)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"encoding"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+var _ encoding.BinaryMarshaler = (*msgpack.Message)(nil)
+var _ encoding.BinaryUnmarshaler = (*msgpack.Message)(nil)
+
+func TestMessage(t *testing.T) {
+	msg, err := msgpack.NewMessage(map[string]interface{}{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := msg.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var msg2 msgpack.Message
+	n, err := msg2.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(n) != len(msg.Bytes()) {
+		t.Fatalf("got %d bytes, wanted %d", n, len(msg.Bytes()))
+	}
+
+	v, err := msg2.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.(map[string]interface{})["foo"] != "bar" {
+		t.Fatalf("got %v", v)
+	}
+
+	var m map[string]string
+	if err := msg2.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if m["foo"] != "bar" {
+		t.Fatalf("got %v", m)
+	}
+
+	b, err := msg2.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg3 msgpack.Message
+	if err := msg3.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg3.Bytes(), msg.Bytes()) {
+		t.Fatalf("got %x, wanted %x", msg3.Bytes(), msg.Bytes())
+	}
+}
+
+func TestMessageInvalid(t *testing.T) {
+	b, err := msgpack.Marshal("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg msgpack.Message
+	if err := msg.UnmarshalBinary(b); err == nil {
+		t.Fatal("got nil error, wanted trailing bytes error")
+	}
+	if err := msg.UnmarshalBinary(b[:2]); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got %v, wanted io.ErrUnexpectedEOF", err)
+	}
+	if _, err := msg.ReadFrom(strings.NewReader("\xc1")); err == nil {
+		t.Fatal("got nil error, wanted invalid code")
+	}
+}
+
+func TestMessageField(t *testing.T) {
+	type envelope struct {
+		ID   int
+		Body *msgpack.Message
+	}
+
+	body, err := msgpack.NewMessage([]int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := msgpack.Marshal(&envelope{ID: 1, Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out envelope
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	var ints []int
+	if err := out.Body.Decode(&ints); err != nil {
+		t.Fatal(err)
+	}
+	if len(ints) != 3 || ints[2] != 3 {
+		t.Fatalf("got %v", ints)
+	}
+
+	var empty msgpack.Message
+	if !bytes.Equal(empty.Bytes(), []byte{0xc0}) {
+		t.Fatalf("got %x, wanted encoded nil", empty.Bytes())
+	}
+}
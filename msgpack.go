@@ -1,5 +1,11 @@
 package msgpack
 
+import "errors"
+
+// ErrInvalidUTF8 is returned by Encoder and Decoder with enabled
+// UTF-8 validation when a string is not valid UTF-8.
+var ErrInvalidUTF8 = errors.New("msgpack: string is not valid UTF-8")
+
 type Marshaler interface {
 	MarshalMsgpack() ([]byte, error)
 }
@@ -15,3 +21,10 @@ type CustomEncoder interface {
 type CustomDecoder interface {
 	DecodeMsgpack(*Decoder) error
 }
+
+// Sizer is implemented by CustomEncoder and Marshaler types that can
+// report the length of their encoding without encoding themselves.
+// It is used by SizeOf.
+type Sizer interface {
+	MsgpackSize() int
+}
@@ -3,6 +3,10 @@ package msgpack_test
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
 	"reflect"
 	"strings"
@@ -264,6 +268,424 @@ func (t *MsgpackTest) TestBin(c *C) {
 	}
 }
 
+func (t *MsgpackTest) TestBytesFromReader(c *C) {
+	for _, n := range []int{0, 255, 256, 65536} {
+		src := bytes.Repeat([]byte{'w'}, n)
+		c.Assert(t.enc.EncodeBytesFromReader(bytes.NewReader(src), n), IsNil)
+		b := append([]byte(nil), t.buf.Bytes()...)
+
+		c.Assert(t.enc.EncodeBytes(src), IsNil)
+		c.Assert(t.buf.Bytes()[len(b):], DeepEquals, b)
+		t.buf.Reset()
+	}
+
+	err := t.enc.EncodeBytesFromReader(strings.NewReader("foo"), 4)
+	c.Assert(err, Equals, io.ErrUnexpectedEOF)
+	t.buf.Reset()
+
+	err = t.enc.EncodeBytesFromReader(strings.NewReader("foo"), -1)
+	c.Assert(err, ErrorMatches, "msgpack: invalid bytes length -1")
+	c.Assert(t.buf.Len(), Equals, 0)
+}
+
+func (t *MsgpackTest) TestRFC3339Time(c *C) {
+	loc := time.FixedZone("", 8*3600)
+	tm := time.Date(2018, 1, 2, 3, 4, 5, 6, loc)
+
+	c.Assert(t.enc.UseRFC3339Time(true).Encode(tm), IsNil)
+
+	var s string
+	c.Assert(t.dec.Decode(&s), IsNil)
+	c.Assert(s, Equals, "2018-01-02T03:04:05.000000006+08:00")
+
+	c.Assert(t.enc.Encode(tm), IsNil)
+	var out time.Time
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out.Equal(tm), Equals, true)
+}
+
+type cycleNode struct {
+	Name     string
+	Next     *cycleNode
+	Children []*cycleNode
+}
+
+func (t *MsgpackTest) TestDetectCycles(c *C) {
+	t.enc.DetectCycles(true)
+
+	a := &cycleNode{Name: "a"}
+	b := &cycleNode{Name: "b", Next: a}
+	a.Next = b
+	c.Assert(t.enc.Encode(a), ErrorMatches, `msgpack: cycle detected at field "Next.Next" \(\*msgpack_test.cycleNode\)`)
+
+	a.Next = nil
+	b.Children = []*cycleNode{a, b}
+	c.Assert(t.enc.Encode(b), ErrorMatches, `msgpack: cycle detected at field "Children.1" \(\*msgpack_test.cycleNode\)`)
+
+	m := map[string]interface{}{"foo": 1}
+	m["self"] = m
+	c.Assert(t.enc.Encode(m), ErrorMatches, `msgpack: cycle detected at field "self" \(map\[string\]interface {}\)`)
+
+	s := []interface{}{nil}
+	s[0] = s
+	c.Assert(t.enc.Encode(s), ErrorMatches, `msgpack: cycle detected at field "0" \(\[\]interface {}\)`)
+
+	// Shared values are not cycles.
+	t.buf.Reset()
+	shared := &cycleNode{Name: "shared"}
+	root := &cycleNode{Children: []*cycleNode{shared, shared}, Next: shared}
+	c.Assert(t.enc.Encode(root), IsNil)
+
+	var out cycleNode
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out.Next.Name, Equals, "shared")
+	c.Assert(out.Children, HasLen, 2)
+}
+
+func (t *MsgpackTest) TestStructArrayEvolution(c *C) {
+	type V1 struct {
+		_msgpack struct{} `msgpack:",asArray"`
+		ID       int
+		Name     string
+	}
+	type V2 struct {
+		_msgpack struct{} `msgpack:",asArray"`
+		ID       int
+		Name     string
+		Email    string
+	}
+
+	c.Assert(t.enc.Encode(&V2{ID: 1, Name: "a", Email: "a@example.com"}, &V1{ID: 2, Name: "b"}), IsNil)
+
+	var v1 V1
+	c.Assert(t.dec.Decode(&v1), IsNil)
+	c.Assert(v1.ID, Equals, 1)
+	c.Assert(v1.Name, Equals, "a")
+
+	var v2 V2
+	c.Assert(t.dec.Decode(&v2), IsNil)
+	c.Assert(v2.ID, Equals, 2)
+	c.Assert(v2.Email, Equals, "")
+
+	t.dec.StrictStructArrays(true)
+	c.Assert(t.enc.Encode(&V1{ID: 3}, &V2{ID: 4}, &V2{ID: 5}), IsNil)
+
+	c.Assert(t.dec.Decode(&v2), ErrorMatches,
+		"msgpack: array of 2 elements does not match 3 fields of msgpack_test.V2")
+	c.Assert(t.dec.Decode(&v1), ErrorMatches,
+		"msgpack: array of 3 elements does not match 2 fields of msgpack_test.V1")
+	c.Assert(t.dec.Decode(&v2), IsNil)
+	c.Assert(v2.ID, Equals, 5)
+}
+
+func (t *MsgpackTest) TestDisallowDuplicateKeys(c *C) {
+	type T struct {
+		Admin bool
+	}
+
+	encodeDup := func(k1, k2 interface{}) {
+		c.Assert(t.enc.EncodeMapLen(2), IsNil)
+		c.Assert(t.enc.Encode(k1, false, k2, true), IsNil)
+	}
+
+	encodeDup("Admin", "Admin")
+	var out T
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out.Admin, Equals, true)
+
+	t.dec.DisallowDuplicateKeys(true)
+
+	encodeDup("Admin", "Admin")
+	c.Assert(t.dec.Decode(&out), ErrorMatches, "msgpack: duplicate map key: Admin")
+
+	c.Assert(t.dec.Skip(), IsNil)
+	encodeDup("Admin", "admin")
+	c.Assert(t.dec.CaseInsensitiveFields(true).Decode(&out), ErrorMatches, "msgpack: duplicate map key: Admin")
+
+	c.Assert(t.dec.Skip(), IsNil)
+	encodeDup("foo", "foo")
+	var m map[string]interface{}
+	c.Assert(t.dec.Decode(&m), ErrorMatches, "msgpack: duplicate map key: foo")
+
+	c.Assert(t.dec.Skip(), IsNil)
+	encodeDup(1, 1)
+	var im map[int]bool
+	c.Assert(t.dec.Decode(&im), ErrorMatches, "msgpack: duplicate map key: 1")
+
+	c.Assert(t.dec.Skip(), IsNil)
+	encodeDup("foo", "bar")
+	c.Assert(t.dec.Decode(&m), IsNil)
+	c.Assert(m, DeepEquals, map[string]interface{}{"foo": false, "bar": true})
+}
+
+func (t *MsgpackTest) TestNonFiniteFloats(c *C) {
+	c.Assert(t.enc.Encode(math.NaN(), math.Inf(1), float32(math.Inf(-1))), IsNil)
+
+	var f64 float64
+	var f32 float32
+	t.dec.RejectNonFiniteFloats(true)
+	c.Assert(t.dec.Decode(&f64), ErrorMatches, "msgpack: non-finite float NaN")
+	c.Assert(t.dec.Decode(&f64), ErrorMatches, `msgpack: non-finite float \+Inf`)
+	c.Assert(t.dec.Decode(&f32), ErrorMatches, "msgpack: non-finite float -Inf")
+
+	t.enc.RejectNonFiniteFloats(true)
+	c.Assert(t.enc.Encode(math.NaN()), ErrorMatches, "msgpack: can't encode non-finite float NaN")
+	c.Assert(t.enc.Encode(float32(math.Inf(1))), ErrorMatches, `msgpack: can't encode non-finite float \+Inf`)
+
+	t.enc.NonFiniteFloatsAsNil(true)
+	c.Assert(t.enc.Encode([]float64{1, math.NaN()}), IsNil)
+	var out []interface{}
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out, DeepEquals, []interface{}{1.0, nil})
+}
+
+func (t *MsgpackTest) TestValidateUTF8(c *C) {
+	invalid := "foo\xffbar"
+
+	c.Assert(t.enc.ValidateUTF8(true).Encode(invalid), Equals, msgpack.ErrInvalidUTF8)
+	c.Assert(t.enc.Encode(map[string]string{"foo": invalid}), Equals, msgpack.ErrInvalidUTF8)
+
+	t.buf.Reset()
+	c.Assert(t.enc.ValidateUTF8(false).Encode(invalid, "héllo"), IsNil)
+
+	var s string
+	c.Assert(t.dec.ValidateUTF8(true).Decode(&s), Equals, msgpack.ErrInvalidUTF8)
+	c.Assert(t.dec.Decode(&s), IsNil)
+	c.Assert(s, Equals, "héllo")
+}
+
+func (t *MsgpackTest) TestTolerantTime(c *C) {
+	tm := time.Unix(1514862245, 500000000)
+
+	b, err := msgpack.Marshal(tm.Unix())
+	c.Assert(err, IsNil)
+	var out time.Time
+	c.Assert(msgpack.Unmarshal(b, &out), NotNil)
+
+	ins := []interface{}{
+		tm,
+		[]interface{}{tm.Unix(), tm.Nanosecond()},
+		tm.Format(time.RFC3339Nano),
+		1514862245.5,
+		tm.Unix(),
+		nil,
+	}
+	c.Assert(t.enc.Encode(ins...), IsNil)
+
+	t.dec.TolerantTime(true)
+	for i, in := range ins {
+		var out time.Time
+		c.Assert(t.dec.Decode(&out), IsNil)
+		switch in.(type) {
+		case int64:
+			c.Assert(out.Equal(tm.Truncate(time.Second)), Equals, true)
+		case nil:
+			c.Assert(out.IsZero(), Equals, true)
+		default:
+			c.Assert(out.Equal(tm), Equals, true, Commentf("i=%d", i))
+		}
+	}
+}
+
+func (t *MsgpackTest) TestZonedTime(c *C) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		c.Skip(err.Error())
+	}
+	tm := time.Date(2018, 1, 2, 3, 4, 5, 6, loc)
+	fixed := time.Date(2018, 1, 2, 3, 4, 5, 6, time.FixedZone("XYZ", -3600))
+
+	c.Assert(t.enc.UseZonedTime(true).Encode(tm, fixed, tm), IsNil)
+
+	var out time.Time
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out.Equal(tm), Equals, true)
+	c.Assert(out.Location().String(), Equals, "Asia/Shanghai")
+	c.Assert(out.Format(time.RFC3339Nano), Equals, tm.Format(time.RFC3339Nano))
+
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out.Format(time.RFC3339Nano), Equals, fixed.Format(time.RFC3339Nano))
+	name, offset := out.Zone()
+	c.Assert(name, Equals, "XYZ")
+	c.Assert(offset, Equals, -3600)
+
+	var iface interface{}
+	c.Assert(t.dec.Decode(&iface), IsNil)
+	c.Assert(iface.(time.Time).Format(time.RFC3339Nano), Equals, tm.Format(time.RFC3339Nano))
+
+	// Locations are loaded once.
+	loaded := iface.(time.Time).Location()
+	c.Assert(t.enc.Encode(tm), IsNil)
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out.Location() == loaded, Equals, true)
+}
+
+func (t *MsgpackTest) TestDurationExt(c *C) {
+	type T struct {
+		Timeout time.Duration
+	}
+	dur := time.Hour + 30*time.Minute
+
+	c.Assert(t.enc.UseDurationExt(true).Encode(T{dur}, dur), IsNil)
+
+	var iface interface{}
+	c.Assert(t.dec.Decode(&iface), IsNil)
+	c.Assert(iface, DeepEquals, map[string]interface{}{"Timeout": dur})
+
+	var out time.Duration
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out, Equals, dur)
+}
+
+func (t *MsgpackTest) TestDurationCompat(c *C) {
+	type T struct {
+		Timeout time.Duration
+	}
+	c.Assert(t.enc.Encode(map[string]interface{}{"Timeout": "1h30m"}, int64(time.Second)), IsNil)
+
+	var out T
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out.Timeout, Equals, time.Hour+30*time.Minute)
+
+	var dur time.Duration
+	c.Assert(t.dec.Decode(&dur), IsNil)
+	c.Assert(dur, Equals, time.Second)
+}
+
+func (t *MsgpackTest) TestCaseInsensitiveFields(c *C) {
+	type T struct {
+		UserID int
+		Name   string
+	}
+	in := map[string]interface{}{"user_id": 1, "NAME": "foo"}
+
+	c.Assert(t.enc.Encode(in), IsNil)
+	var out T
+	c.Assert(t.dec.Decode(&out), IsNil)
+	c.Assert(out, DeepEquals, T{})
+
+	c.Assert(t.enc.Encode(in), IsNil)
+	c.Assert(t.dec.CaseInsensitiveFields(true).Decode(&out), IsNil)
+	c.Assert(out, DeepEquals, T{UserID: 1, Name: "foo"})
+}
+
+func (t *MsgpackTest) TestDecodeBytesTo(c *C) {
+	src := bytes.Repeat([]byte{'w'}, 65536)
+	c.Assert(t.enc.Encode(src, nil), IsNil)
+
+	var dst bytes.Buffer
+	n, err := t.dec.DecodeBytesTo(&dst)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(len(src)))
+	c.Assert(dst.Bytes(), DeepEquals, src)
+
+	n, err = t.dec.DecodeBytesTo(&dst)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, int64(0))
+}
+
+func (t *MsgpackTest) TestDecodeBytesInto(c *C) {
+	c.Assert(t.enc.Encode([]byte("hello"), []byte("hello world"), "foo"), IsNil)
+
+	buf := make([]byte, 8)
+	n, err := t.dec.DecodeBytesInto(buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "hello")
+
+	_, err = t.dec.DecodeBytesInto(buf)
+	c.Assert(err, ErrorMatches, "msgpack: buffer len is 8, but msgpack has 11 bytes")
+
+	n, err = t.dec.DecodeBytesInto(buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "foo")
+
+	c.Assert(t.enc.Encode(bytes.Repeat([]byte{'w'}, 1<<20), "bar"), IsNil)
+
+	_, err = t.dec.DecodeBytesInto(buf)
+	c.Assert(err, ErrorMatches, "msgpack: buffer len is 8, but msgpack has 1048576 bytes")
+
+	n, err = t.dec.DecodeBytesInto(buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf[:n]), Equals, "bar")
+}
+
+func (t *MsgpackTest) TestDecodeArrayFunc(c *C) {
+	c.Assert(t.enc.Encode([]string{"a", "b", "c"}, nil, "next"), IsNil)
+
+	var got []string
+	err := t.dec.DecodeArrayFunc(func(i int, d *msgpack.Decoder) error {
+		c.Assert(i, Equals, len(got))
+		s, err := d.DecodeString()
+		got = append(got, s)
+		return err
+	})
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, []string{"a", "b", "c"})
+
+	err = t.dec.DecodeArrayFunc(func(i int, d *msgpack.Decoder) error {
+		c.Fatal("nil array has no elements")
+		return nil
+	})
+	c.Assert(err, IsNil)
+
+	s, err := t.dec.DecodeString()
+	c.Assert(err, IsNil)
+	c.Assert(s, Equals, "next")
+}
+
+func (t *MsgpackTest) TestDecodeMapFunc(c *C) {
+	c.Assert(t.enc.Encode(map[string]int{"a": 1, "b": 2}), IsNil)
+
+	got := make(map[string]int)
+	err := t.dec.DecodeMapFunc(func(d *msgpack.Decoder) error {
+		k, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+		v, err := d.DecodeInt()
+		if err != nil {
+			return err
+		}
+		got[k] = v
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(got, DeepEquals, map[string]int{"a": 1, "b": 2})
+
+	c.Assert(t.enc.Encode(map[string]int{"a": 1}), IsNil)
+	err = t.dec.DecodeMapFunc(func(d *msgpack.Decoder) error {
+		return errors.New("stop")
+	})
+	c.Assert(err, ErrorMatches, "stop")
+}
+
+func (t *MsgpackTest) TestPeekNextType(c *C) {
+	values := []interface{}{
+		nil, true, -1, int8(-100), 1, uint64(1 << 40), 1.5, float32(2.5),
+		"foo", []byte("bar"), []int{1}, map[string]int{"a": 1}, time.Now(),
+	}
+	types := []msgpack.Type{
+		msgpack.NilType, msgpack.BoolType, msgpack.IntType, msgpack.IntType,
+		msgpack.UintType, msgpack.UintType, msgpack.FloatType, msgpack.FloatType,
+		msgpack.StringType, msgpack.BinaryType, msgpack.ArrayType, msgpack.MapType,
+		msgpack.ExtType,
+	}
+	c.Assert(t.enc.Encode(values...), IsNil)
+
+	for _, typ := range types {
+		got, err := t.dec.PeekNextType()
+		c.Assert(err, IsNil)
+		c.Assert(got, Equals, typ)
+		c.Assert(t.dec.Skip(), IsNil)
+	}
+
+	t.buf.WriteByte(0xc1)
+	typ, err := t.dec.PeekNextType()
+	c.Assert(err, ErrorMatches, "msgpack: invalid code=c1")
+	c.Assert(typ, Equals, msgpack.InvalidType)
+	c.Assert(typ.String(), Equals, "invalid")
+}
+
 func (t *MsgpackTest) TestString(c *C) {
 	highFixStr := strings.Repeat("w", 31)
 	lowStr8 := strings.Repeat("w", 32)
@@ -486,6 +908,117 @@ type Struct3 struct {
 	Name1 string
 }
 
+func TestDecoderBuffered(t *testing.T) {
+	b, err := msgpack.Marshal("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// io.MultiReader is not buffered so the Decoder reads ahead.
+	r := io.MultiReader(bytes.NewReader(append(b, "rest of the stream"...)))
+	dec := msgpack.NewDecoder(r)
+
+	s, err := dec.DecodeString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "hello" {
+		t.Fatalf("got %q, wanted hello", s)
+	}
+
+	rest, err := ioutil.ReadAll(io.MultiReader(dec.Buffered(), r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "rest of the stream" {
+		t.Fatalf("got %q", rest)
+	}
+
+	// Nothing is read ahead from buffered readers.
+	br := bytes.NewReader(append(b, "rest"...))
+	dec = msgpack.NewDecoder(br)
+	if _, err := dec.DecodeString(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := dec.Buffered().Read(make([]byte, 10)); n != 0 {
+		t.Fatalf("got %d buffered bytes, wanted 0", n)
+	}
+	if br.Len() != 4 {
+		t.Fatalf("got %d unread bytes, wanted 4", br.Len())
+	}
+}
+
+func TestStructMapKeys(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	type tile struct {
+		Kind string
+	}
+
+	in := make(map[point]tile)
+	for x := 0; x < 10; x++ {
+		for y := 0; y < 10; y++ {
+			in[point{x, y}] = tile{Kind: fmt.Sprint(x * y)}
+		}
+	}
+
+	var first []byte
+	for i := 0; i < 5; i++ {
+		var buf bytes.Buffer
+		if err := msgpack.NewEncoder(&buf).SortMapKeys(true).Encode(in); err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = buf.Bytes()
+		} else if !bytes.Equal(buf.Bytes(), first) {
+			t.Fatal("encoding of map with sorted keys is not deterministic")
+		}
+	}
+
+	var out map[point]tile
+	if err := msgpack.Unmarshal(first, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got %v, wanted %v", out, in)
+	}
+
+	// Keys are encoded as arrays.
+	b, err := msgpack.Marshal(map[point]int{{1, 2}: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := []byte{0x81, 0x92, 0x01, 0x02, 0x03}
+	if !bytes.Equal(b, wanted) {
+		t.Fatalf("got %x, wanted %x", b, wanted)
+	}
+}
+
+func TestSortMapKeysInt(t *testing.T) {
+	var buf bytes.Buffer
+	in := map[int]bool{3: true, -1: true, 200: false, 0: true}
+	if err := msgpack.NewEncoder(&buf).SortMapKeys(true).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(&buf)
+	var keys []int
+	err := dec.DecodeMapFunc(func(d *msgpack.Decoder) error {
+		k, err := d.DecodeInt()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+		return d.Skip()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []int{-1, 0, 3, 200}) {
+		t.Fatalf("got %v", keys)
+	}
+}
+
 func TestEmbedding(t *testing.T) {
 	in := &Struct3{
 		Name1: "hello",
@@ -539,3 +1072,32 @@ func (t *MsgpackTest) TestMapStringInterface(c *C) {
 	mm := out["hello"].(map[string]interface{})
 	c.Assert(mm["foo"], Equals, "bar")
 }
+
+func TestUnmarshalTrailingBytes(t *testing.T) {
+	b, err := msgpack.Marshal("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s string
+	err = msgpack.Unmarshal(b, &s)
+	if err == nil || err.Error() != "msgpack: 4 bytes remain after the value" {
+		t.Fatalf("got %v, wanted trailing bytes error", err)
+	}
+
+	n, err := msgpack.UnmarshalPrefix(b, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 || s != "foo" {
+		t.Fatalf("got %d %q, wanted 4 foo", n, s)
+	}
+
+	var s2 string
+	if err := msgpack.Unmarshal(b, &s, &s2); err != nil {
+		t.Fatal(err)
+	}
+	if s2 != "bar" {
+		t.Fatalf("got %q, wanted bar", s2)
+	}
+}
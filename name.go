@@ -0,0 +1,94 @@
+package msgpack
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// typeNameExtId is the ext id used to tag interface values with the name
+// of their concrete type. Ids used by this package are allocated from the
+// bottom of the range reserved by the spec to stay away from the ids
+// the spec defines, e.g. -1 for timestamps.
+var typeNameExtId int8 = -128
+
+var namedTypes = make(map[string]reflect.Type)
+var typeNames = make(map[reflect.Type]string)
+
+// RegisterName records a type, identified by a value for that type,
+// under the provided name. Values of that type stored in interface values
+// are encoded together with the name, so they can be decoded into
+// interface values with the same concrete type. Only the exact type is
+// registered: if value is a pointer, decoded values are pointers as well.
+// Expecting to be used only during initialization, it panics if the mapping
+// between types and names is not a bijection.
+func RegisterName(name string, value interface{}) {
+	if name == "" {
+		panic("msgpack: attempt to register empty name")
+	}
+
+	typ := reflect.TypeOf(value)
+
+	typesMu.Lock()
+	defer typesMu.Unlock()
+
+	if t, ok := namedTypes[name]; ok && t != typ {
+		panic(fmt.Errorf("msgpack: registering duplicate types for %q: %s != %s", name, t, typ))
+	}
+	if n, ok := typeNames[typ]; ok && n != name {
+		panic(fmt.Errorf("msgpack: registering duplicate names for %s: %q != %q", typ, n, name))
+	}
+
+	namedTypes[name] = typ
+	typeNames[typ] = name
+}
+
+func typeName(typ reflect.Type) (string, bool) {
+	typesMu.RLock()
+	name, ok := typeNames[typ]
+	typesMu.RUnlock()
+	return name, ok
+}
+
+func namedType(name string) (reflect.Type, bool) {
+	typesMu.RLock()
+	typ, ok := namedTypes[name]
+	typesMu.RUnlock()
+	return typ, ok
+}
+
+// encodeInterface encodes v stored in an interface value.
+func (e *Encoder) encodeInterface(v interface{}) error {
+	if v != nil {
+		if name, ok := typeName(reflect.TypeOf(v)); ok {
+			return e.encodeNamedValue(name, reflect.ValueOf(v))
+		}
+	}
+	return e.encode(v)
+}
+
+func (e *Encoder) encodeNamedValue(name string, v reflect.Value) error {
+	return e.encodeExt(typeNameExtId, func(e *Encoder) error {
+		if err := e.EncodeString(name); err != nil {
+			return err
+		}
+		return e.EncodeValue(v)
+	})
+}
+
+func (d *Decoder) decodeNamedValue() (interface{}, error) {
+	name, err := d.DecodeString()
+	if err != nil {
+		return nil, err
+	}
+
+	typ, ok := namedType(name)
+	if !ok {
+		return nil, fmt.Errorf("msgpack: name not registered for interface: %q", name)
+	}
+
+	v := reflect.New(typ).Elem()
+	if err := d.DecodeValue(v); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,88 @@
+package msgpack_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type shape interface {
+	Area() float64
+}
+
+type circle struct {
+	R float64
+}
+
+func (c circle) Area() float64 { return 3 * c.R * c.R }
+
+type square struct {
+	Side float64
+}
+
+func (s *square) Area() float64 { return s.Side * s.Side }
+
+type drawing struct {
+	Main   shape
+	Shapes []shape
+	Attrs  map[string]interface{}
+}
+
+func init() {
+	msgpack.RegisterName("msgpack_test.circle", circle{})
+	msgpack.RegisterName("msgpack_test.square", (*square)(nil))
+}
+
+func TestRegisterName(t *testing.T) {
+	in := &drawing{
+		Main:   circle{R: 1},
+		Shapes: []shape{&square{Side: 2}, circle{R: 3}, nil},
+		Attrs:  map[string]interface{}{"background": &square{Side: 4}},
+	}
+
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out drawing
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&out, in) {
+		t.Fatalf("got %#v, wanted %#v", out, in)
+	}
+}
+
+func TestRegisterNameUnknownName(t *testing.T) {
+	name := "msgpack_test.oval"
+	b := []byte{0xc7, byte(len(name) + 2), 0x80, 0xa0 | byte(len(name))}
+	b = append(b, name...)
+	b = append(b, 0xc0)
+
+	var out interface{}
+	err := msgpack.Unmarshal(b, &out)
+	if err == nil {
+		t.Fatalf("got nil, wanted error")
+	}
+	wanted := `msgpack: name not registered for interface: "msgpack_test.oval"`
+	if err.Error() != wanted {
+		t.Fatalf("got %q, wanted %q", err, wanted)
+	}
+}
+
+func TestRegisterNamePanic(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatalf("panic expected")
+		}
+		got := r.(error).Error()
+		wanted := `msgpack: registering duplicate types for "msgpack_test.circle": msgpack_test.circle != msgpack_test.square`
+		if got != wanted {
+			t.Fatalf("got %q, wanted %q", got, wanted)
+		}
+	}()
+	msgpack.RegisterName("msgpack_test.circle", square{})
+}
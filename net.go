@@ -0,0 +1,96 @@
+package msgpack
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+func init() {
+	ipType := reflect.TypeOf((*net.IP)(nil)).Elem()
+	registerBuiltin(ipType, encodeIPValue, decodeIPValue)
+
+	urlType := reflect.TypeOf((*url.URL)(nil)).Elem()
+	registerBuiltin(urlType, encodeURLValue, decodeURLValue)
+}
+
+func isStringCode(c codes.Code) bool {
+	return codes.IsFixedString(c) || c == codes.Str8 || c == codes.Str16 || c == codes.Str32
+}
+
+// encodeIPValue encodes net.IP as bin with 4 bytes for IPv4 addresses
+// and 16 bytes for IPv6 addresses.
+func encodeIPValue(e *Encoder, v reflect.Value) error {
+	ip := v.Interface().(net.IP)
+	if ip == nil {
+		return e.EncodeNil()
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return e.EncodeBytes(ip)
+}
+
+// decodeIPValue decodes net.IP from bin. Strings are parsed
+// as textual representation of the address.
+func decodeIPValue(d *Decoder, v reflect.Value) error {
+	c, err := d.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	var ip net.IP
+	if isStringCode(c) {
+		s, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+		ip = net.ParseIP(s)
+		if ip == nil {
+			return fmt.Errorf("msgpack: invalid IP address: %q", s)
+		}
+	} else {
+		b, err := d.DecodeBytes()
+		if err != nil {
+			return err
+		}
+		if b != nil && len(b) != net.IPv4len && len(b) != net.IPv6len {
+			return fmt.Errorf("msgpack: invalid IP address len=%d", len(b))
+		}
+		ip = net.IP(b)
+	}
+
+	v.Set(reflect.ValueOf(ip))
+	return nil
+}
+
+func encodeURLValue(e *Encoder, v reflect.Value) error {
+	u := v.Interface().(url.URL)
+	return e.EncodeString(u.String())
+}
+
+// decodeURLValue decodes url.URL from string. Maps produced by older
+// versions that encoded url.URL as a struct are supported as well.
+func decodeURLValue(d *Decoder, v reflect.Value) error {
+	c, err := d.PeekCode()
+	if err != nil {
+		return err
+	}
+	if codes.IsFixedMap(c) || c == codes.Map16 || c == codes.Map32 {
+		return decodeStructValue(d, v)
+	}
+
+	s, err := d.DecodeString()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(*u))
+	return nil
+}
@@ -0,0 +1,55 @@
+//go:build go1.18
+// +build go1.18
+
+package msgpack
+
+import (
+	"net/netip"
+	"reflect"
+)
+
+func init() {
+	addrType := reflect.TypeOf((*netip.Addr)(nil)).Elem()
+	registerBuiltin(addrType, encodeAddrValue, decodeAddrValue)
+}
+
+// encodeAddrValue encodes netip.Addr as bin using its binary form:
+// 4 bytes for IPv4 addresses, 16 bytes and optional zone for IPv6
+// addresses and no bytes for the zero Addr.
+func encodeAddrValue(e *Encoder, v reflect.Value) error {
+	addr := v.Interface().(netip.Addr)
+	b, err := addr.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return e.EncodeBytes(b)
+}
+
+func decodeAddrValue(d *Decoder, v reflect.Value) error {
+	c, err := d.PeekCode()
+	if err != nil {
+		return err
+	}
+
+	var addr netip.Addr
+	if isStringCode(c) {
+		s, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+		if err := addr.UnmarshalText([]byte(s)); err != nil {
+			return err
+		}
+	} else {
+		b, err := d.DecodeBytes()
+		if err != nil {
+			return err
+		}
+		if err := addr.UnmarshalBinary(b); err != nil {
+			return err
+		}
+	}
+
+	v.Set(reflect.ValueOf(addr))
+	return nil
+}
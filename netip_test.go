@@ -0,0 +1,47 @@
+//go:build go1.18
+// +build go1.18
+
+package msgpack_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestNetipAddr(t *testing.T) {
+	for _, in := range []netip.Addr{
+		{},
+		netip.MustParseAddr("1.2.3.4"),
+		netip.MustParseAddr("fe80::1%eth0"),
+	} {
+		b, err := msgpack.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Is4() && len(b) != 6 {
+			t.Fatalf("got %d bytes, wanted 6", len(b))
+		}
+
+		var out netip.Addr
+		if err := msgpack.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != in {
+			t.Fatalf("got %s, wanted %s", out, in)
+		}
+	}
+
+	b, err := msgpack.Marshal("::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out netip.Addr
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != netip.IPv6Loopback() {
+		t.Fatalf("got %s, wanted ::1", out)
+	}
+}
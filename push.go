@@ -0,0 +1,188 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// PushDecoder splits MessagePack data arriving in arbitrary chunks,
+// e.g. TCP segments, into complete values without blocking in Read.
+// It is meant for event loops that receive data themselves and
+// feed it to the decoder.
+type PushDecoder struct {
+	buf []byte
+	// pos is the number of scanned bytes of the value at the start of buf.
+	pos int
+	// pending is the number of values that must be scanned
+	// to complete the value.
+	pending int
+	maxSize int64
+}
+
+func NewPushDecoder() *PushDecoder {
+	return &PushDecoder{
+		pending: 1,
+	}
+}
+
+// Feed appends p to the buffered data and returns values completed by it.
+// Each complete value is scanned once no matter how many chunks it is
+// split into. Returned messages are not affected by subsequent calls and
+// can be decoded with Unmarshal. After an error the decoder must not be
+// used.
+func (d *PushDecoder) Feed(p []byte) ([]RawMessage, error) {
+	d.buf = append(d.buf, p...)
+
+	var msgs []RawMessage
+	for len(d.buf) > 0 {
+		complete, err := d.scan()
+		if err != nil {
+			return msgs, err
+		}
+		if !complete {
+			break
+		}
+		msgs = append(msgs, RawMessage(d.buf[:d.pos:d.pos]))
+		d.buf = d.buf[d.pos:]
+		d.pos = 0
+		d.pending = 1
+	}
+	if len(d.buf) == 0 {
+		// Don't keep returned messages alive.
+		d.buf = nil
+	}
+	return msgs, nil
+}
+
+// SetMaxMessageSize limits the size of a single value. A value whose
+// declared lengths can't fit into n bytes is rejected with
+// ErrLimitExceeded as soon as its header arrives, before its data
+// is buffered. Zero or negative n disables the limit.
+func (d *PushDecoder) SetMaxMessageSize(n int) {
+	d.maxSize = int64(n)
+}
+
+// Buffered returns the number of bytes of the incomplete value.
+func (d *PushDecoder) Buffered() int {
+	return len(d.buf)
+}
+
+// scan advances over buffered values and reports whether
+// the value at the start of the buffer is complete.
+func (d *PushDecoder) scan() (bool, error) {
+	for d.pending > 0 {
+		n, elems, err := headerLen(d.buf[d.pos:])
+		if err != nil {
+			return false, err
+		}
+		if n == 0 {
+			return false, nil
+		}
+		// Each of the remaining values takes at least one byte.
+		if d.maxSize > 0 && int64(d.pos+n)+int64(d.pending-1+elems) > d.maxSize {
+			return false, ErrLimitExceeded
+		}
+		if d.pos+n > len(d.buf) {
+			return false, nil
+		}
+		d.pos += n
+		d.pending += elems - 1
+	}
+	return true, nil
+}
+
+// headerLen returns the length of the value in b excluding elements of
+// arrays and maps, and the number of values that follow it as part of
+// the value. It returns zero length if b is too short to tell.
+func headerLen(b []byte) (n int, elems int, err error) {
+	if len(b) == 0 {
+		return 0, 0, nil
+	}
+	c := codes.Code(b[0])
+
+	switch {
+	case codes.IsFixedNum(c):
+		return 1, 0, nil
+	case codes.IsFixedMap(c):
+		return 1, 2 * int(c&codes.FixedMapMask), nil
+	case codes.IsFixedArray(c):
+		return 1, int(c & codes.FixedArrayMask), nil
+	case codes.IsFixedString(c):
+		return 1 + int(c&codes.FixedStrMask), 0, nil
+	}
+
+	switch c {
+	case codes.Nil, codes.False, codes.True:
+		return 1, 0, nil
+	case codes.Uint8, codes.Int8:
+		return 2, 0, nil
+	case codes.Uint16, codes.Int16:
+		return 3, 0, nil
+	case codes.Uint32, codes.Int32, codes.Float:
+		return 5, 0, nil
+	case codes.Uint64, codes.Int64, codes.Double:
+		return 9, 0, nil
+	case codes.FixExt1:
+		return 3, 0, nil
+	case codes.FixExt2:
+		return 4, 0, nil
+	case codes.FixExt4:
+		return 6, 0, nil
+	case codes.FixExt8:
+		return 10, 0, nil
+	case codes.FixExt16:
+		return 18, 0, nil
+	case codes.Ext8:
+		if len(b) < 3 {
+			return 0, 0, nil
+		}
+		return 3 + int(b[1]), 0, nil
+	}
+
+	// Values with length.
+	var hdr, lenSize, elemsPerLen int
+	switch c {
+	case codes.Str8, codes.Bin8:
+		hdr, lenSize = 2, 1
+	case codes.Str16, codes.Bin16:
+		hdr, lenSize = 3, 2
+	case codes.Str32, codes.Bin32:
+		hdr, lenSize = 5, 4
+	case codes.Ext16:
+		hdr, lenSize = 4, 2
+	case codes.Ext32:
+		hdr, lenSize = 6, 4
+	case codes.Array16:
+		hdr, lenSize, elemsPerLen = 3, 2, 1
+	case codes.Array32:
+		hdr, lenSize, elemsPerLen = 5, 4, 1
+	case codes.Map16:
+		hdr, lenSize, elemsPerLen = 3, 2, 2
+	case codes.Map32:
+		hdr, lenSize, elemsPerLen = 5, 4, 2
+	default:
+		return 0, 0, fmt.Errorf("msgpack: invalid code=%x", c)
+	}
+	if len(b) < 1+lenSize {
+		return 0, 0, nil
+	}
+	l := lenAt(b, lenSize)
+	if elemsPerLen > 0 {
+		return hdr, elemsPerLen * l, nil
+	}
+	return hdr + l, 0, nil
+}
+
+// lenAt decodes size bytes of big-endian length following the code.
+func lenAt(b []byte, size int) int {
+	switch size {
+	case 1:
+		return int(b[1])
+	case 2:
+		return int(binary.BigEndian.Uint16(b[1:]))
+	default:
+		return int(binary.BigEndian.Uint32(b[1:]))
+	}
+}
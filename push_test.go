@@ -0,0 +1,171 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestPushDecoder(t *testing.T) {
+	values := []interface{}{
+		nil,
+		true,
+		int64(-1),
+		int64(1 << 40),
+		1.5,
+		"hello",
+		strings.Repeat("x", 70000),
+		[]byte{1, 2, 3},
+		[]interface{}{int64(1), []interface{}{"a", map[string]interface{}{"b": int64(2)}}},
+		map[string]interface{}{"key": []interface{}{nil, false}},
+		time.Unix(1e9, 0),
+		make([]interface{}, 20),
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := buf.Bytes()
+
+	for _, chunkSize := range []int{1, 2, 7, 1000, len(b)} {
+		d := msgpack.NewPushDecoder()
+		var msgs []msgpack.RawMessage
+		for i := 0; i < len(b); i += chunkSize {
+			end := i + chunkSize
+			if end > len(b) {
+				end = len(b)
+			}
+			got, err := d.Feed(b[i:end])
+			if err != nil {
+				t.Fatal(err)
+			}
+			msgs = append(msgs, got...)
+		}
+		if d.Buffered() != 0 {
+			t.Fatalf("got %d buffered bytes, wanted 0", d.Buffered())
+		}
+		if len(msgs) != len(values) {
+			t.Fatalf("chunk size %d: got %d values, wanted %d", chunkSize, len(msgs), len(values))
+		}
+		for i, msg := range msgs {
+			var v interface{}
+			if err := msgpack.Unmarshal(msg, &v); err != nil {
+				t.Fatal(err)
+			}
+			wanted := values[i]
+			if tm, ok := wanted.(time.Time); ok {
+				if !v.(time.Time).Equal(tm) {
+					t.Fatalf("got %v, wanted %v", v, tm)
+				}
+				continue
+			}
+			if !reflect.DeepEqual(v, wanted) {
+				t.Fatalf("chunk size %d: got %#v, wanted %#v", chunkSize, v, wanted)
+			}
+		}
+	}
+}
+
+func TestPushDecoderPartial(t *testing.T) {
+	b, err := msgpack.Marshal([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := msgpack.NewPushDecoder()
+	msgs, err := d.Feed(b[:len(b)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("got %d values, wanted 0", len(msgs))
+	}
+	if d.Buffered() != len(b)-1 {
+		t.Fatalf("got %d buffered bytes, wanted %d", d.Buffered(), len(b)-1)
+	}
+
+	msgs, err = d.Feed(append(b[len(b)-1:], 0xc1))
+	if err == nil {
+		t.Fatal("got nil error, wanted invalid code")
+	}
+	if len(msgs) != 1 || !bytes.Equal(msgs[0], b) {
+		t.Fatalf("got %v, wanted %v", msgs, b)
+	}
+}
+
+func TestPushDecoderMaxMessageSize(t *testing.T) {
+	d := msgpack.NewPushDecoder()
+	d.SetMaxMessageSize(8)
+
+	msgs, err := d.Feed([]byte{0x93, 0x01, 0x02, 0x03, 0xa3, 'f', 'o', 'o'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d values, wanted 2", len(msgs))
+	}
+
+	// Declared lengths are checked before the data arrives.
+	tests := [][]byte{
+		{0xdb, 0x00, 0x10, 0x00, 0x00},
+		{0xdd, 0x00, 0x00, 0x00, 0x08},
+		{0x92, 0xa7},
+	}
+	for _, b := range tests {
+		d := msgpack.NewPushDecoder()
+		d.SetMaxMessageSize(8)
+		if _, err := d.Feed(b); err != msgpack.ErrLimitExceeded {
+			t.Fatalf("%x: got %v, wanted ErrLimitExceeded", b, err)
+		}
+	}
+}
+
+func TestRawMessage(t *testing.T) {
+	type envelope struct {
+		Type    string
+		Payload msgpack.RawMessage
+	}
+
+	payload, err := msgpack.Marshal(map[string]int{"x": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := msgpack.Marshal(envelope{Type: "point", Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out envelope
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Type != "point" || !bytes.Equal(out.Payload, payload) {
+		t.Fatalf("got %+v", out)
+	}
+
+	var m map[string]int
+	if err := msgpack.Unmarshal(out.Payload, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["x"] != 1 {
+		t.Fatalf("got %v", m)
+	}
+
+	b, err = msgpack.Marshal(envelope{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Payload) != 0 {
+		t.Fatalf("got %v, wanted empty payload", out.Payload)
+	}
+}
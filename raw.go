@@ -0,0 +1,32 @@
+package msgpack
+
+// RawMessage is a raw encoded MessagePack value. It can be used
+// to delay decoding of a value or to precompute its encoding.
+type RawMessage []byte
+
+var _ CustomEncoder = (RawMessage)(nil)
+var _ CustomDecoder = (*RawMessage)(nil)
+var _ Sizer = (RawMessage)(nil)
+
+func (m RawMessage) EncodeMsgpack(e *Encoder) error {
+	if len(m) == 0 {
+		return e.EncodeNil()
+	}
+	return e.write(m)
+}
+
+func (m *RawMessage) DecodeMsgpack(d *Decoder) error {
+	b, err := d.readRaw()
+	if err != nil {
+		return err
+	}
+	*m = b
+	return nil
+}
+
+func (m RawMessage) MsgpackSize() int {
+	if len(m) == 0 {
+		return 1
+	}
+	return len(m)
+}
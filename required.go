@@ -0,0 +1,37 @@
+package msgpack
+
+import (
+	"strings"
+)
+
+// RequiredFieldsError is returned by Decoder when fields with the
+// required tag option are missing in the decoded data. Decoding
+// continues after a missing field, so the error lists all of them.
+type RequiredFieldsError struct {
+	// Paths to the missing fields relative to the decoded value,
+	// e.g. "Items[1].Name".
+	Paths []string
+}
+
+func (e *RequiredFieldsError) Error() string {
+	return "msgpack: missing required fields: " + strings.Join(e.Paths, ", ")
+}
+
+// collectRequired appends paths from err to missing if err is
+// a *RequiredFieldsError for a value decoded at name and reports
+// whether it did so. The value is fully decoded in that case,
+// so decoding can continue.
+func collectRequired(missing *[]string, name string, err error) bool {
+	reqErr, ok := err.(*RequiredFieldsError)
+	if !ok {
+		return false
+	}
+	for _, path := range reqErr.Paths {
+		if strings.HasPrefix(path, "[") {
+			*missing = append(*missing, name+path)
+		} else {
+			*missing = append(*missing, name+"."+path)
+		}
+	}
+	return true
+}
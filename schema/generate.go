@@ -0,0 +1,127 @@
+package schema
+
+import (
+	"net"
+	"net/url"
+	"reflect"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	ipType       = reflect.TypeOf(net.IP(nil))
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// Generate returns the schema of values of Go type typ as encoded by
+// msgpack.Encoder with default options. Field order, names and tags
+// follow the struct definitions. Named struct types are placed in
+// Definitions of the returned schema and referenced by their Go type
+// name, which keeps recursive types finite. Names of different types
+// that are the same are qualified with the full package path. Types with custom encoding
+// are described as Any.
+//
+// The result can be serialized with encoding/json and shared with
+// implementations in other languages.
+func Generate(typ reflect.Type) *Schema {
+	g := &generator{
+		defs:  make(map[string]*Schema),
+		names: make(map[reflect.Type]string),
+	}
+	s := g.schema(typ)
+	if len(g.defs) > 0 {
+		s.Definitions = g.defs
+	}
+	return s
+}
+
+type generator struct {
+	defs  map[string]*Schema
+	names map[reflect.Type]string
+}
+
+func (g *generator) schema(typ reflect.Type) *Schema {
+	if id, ok := msgpack.ExtID(typ); ok {
+		return &Schema{Type: Ext, ExtID: &id}
+	}
+	switch typ {
+	case durationType:
+		return &Schema{Type: Int}
+	case ipType:
+		return &Schema{Type: Bytes, Nullable: true}
+	case urlType:
+		return &Schema{Type: String}
+	}
+	if msgpack.HasCustomEncoding(typ) {
+		return &Schema{Type: Any}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Bool}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Int}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Float}
+	case reflect.String:
+		return &Schema{Type: String}
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Bytes, Nullable: true}
+		}
+		return &Schema{Type: Array, Nullable: true, Elem: g.schema(typ.Elem())}
+	case reflect.Array:
+		n := typ.Len()
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Bytes, MinLen: &n, MaxLen: &n}
+		}
+		return &Schema{Type: Array, MinLen: &n, MaxLen: &n, Elem: g.schema(typ.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Map, Nullable: true, Elem: g.schema(typ.Elem())}
+	case reflect.Ptr:
+		s := g.schema(typ.Elem())
+		s.Nullable = true
+		return s
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return g.structSchema(typ)
+		}
+		name, ok := g.names[typ]
+		if !ok {
+			name = typ.String()
+			if _, ok := g.defs[name]; ok {
+				// Another package has a type with the same name.
+				name = typ.PkgPath() + "." + typ.Name()
+			}
+			// Reserve the name before generating fields
+			// that may refer to the type itself.
+			g.names[typ] = name
+			def := new(Schema)
+			g.defs[name] = def
+			*def = *g.structSchema(typ)
+		}
+		return &Schema{Ref: name}
+	}
+	return &Schema{Type: Any}
+}
+
+func (g *generator) structSchema(typ reflect.Type) *Schema {
+	fields, asArray := msgpack.StructFields(typ)
+	s := &Schema{Type: Map}
+	if asArray {
+		s.Type = Array
+	}
+	s.Fields = make([]*Field, len(fields))
+	for i, f := range fields {
+		s.Fields[i] = &Field{
+			Name:     f.Name,
+			Required: asArray || !f.OmitEmpty,
+			Schema:   g.schema(f.Type),
+			Tag:      f.Tag,
+		}
+	}
+	return s
+}
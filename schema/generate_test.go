@@ -0,0 +1,105 @@
+package schema_test
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"reflect"
+	"testing"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/vmihailenco/msgpack/schema"
+)
+
+type lineItem struct {
+	_msgpack struct{} `msgpack:",asArray"`
+	SKU      string
+	Qty      uint16
+}
+
+type order struct {
+	ID      int64                  `msgpack:"id"`
+	Created time.Time              `msgpack:"created"`
+	Items   []lineItem             `msgpack:"items"`
+	Note    string                 `msgpack:"note,omitempty"`
+	Parent  *order                 `msgpack:"parent"`
+	Meta    map[string]interface{} `msgpack:"meta,omitempty"`
+}
+
+func TestGenerate(t *testing.T) {
+	s := schema.Generate(reflect.TypeOf(order{}))
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := `{"ref":"schema_test.order","definitions":{` +
+		`"schema_test.lineItem":{"type":"array","fields":[` +
+		`{"name":"SKU","required":true,"schema":{"type":"string"}},` +
+		`{"name":"Qty","required":true,"schema":{"type":"int"}}]},` +
+		`"schema_test.order":{"type":"map","fields":[` +
+		`{"name":"id","required":true,"schema":{"type":"int"},"tag":"id"},` +
+		`{"name":"created","required":true,"schema":{"type":"ext","ext_id":-1},"tag":"created"},` +
+		`{"name":"items","required":true,"schema":{"type":"array","nullable":true,"elem":{"ref":"schema_test.lineItem"}},"tag":"items"},` +
+		`{"name":"note","schema":{"type":"string"},"tag":"note,omitempty"},` +
+		`{"name":"parent","required":true,"schema":{"nullable":true,"ref":"schema_test.order"},"tag":"parent"},` +
+		`{"name":"meta","schema":{"type":"map","nullable":true,"elem":{"type":"any"}},"tag":"meta,omitempty"}]}}}`
+	if string(b) != wanted {
+		t.Fatalf("got\n%s\nwanted\n%s", b, wanted)
+	}
+
+	in := order{
+		ID:      1,
+		Created: time.Unix(1e9, 0),
+		Items:   []lineItem{{SKU: "a", Qty: 2}},
+		Parent:  &order{ID: 2},
+		Meta:    map[string]interface{}{"k": "v"},
+	}
+	data, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// The generated schema survives a JSON round trip.
+	var s2 schema.Schema
+	if err := json.Unmarshal(b, &s2); err != nil {
+		t.Fatal(err)
+	}
+	data, err = msgpack.Marshal(map[string]interface{}{
+		"id":      1,
+		"created": time.Now(),
+		"items":   []interface{}{[]interface{}{"a", "many"}},
+		"parent":  nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s2.Validate(data)
+	if err == nil || err.Error() != "msgpack: schema: items[0].Qty: got string, wanted int" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestGenerateSameTypeNames(t *testing.T) {
+	var templates struct {
+		Text texttemplate.Template
+		HTML htmltemplate.Template
+	}
+	s := schema.Generate(reflect.TypeOf(templates))
+
+	if ref := s.Fields[0].Schema.Ref; ref != "template.Template" {
+		t.Fatalf("got %q", ref)
+	}
+	if ref := s.Fields[1].Schema.Ref; ref != "html/template.Template" {
+		t.Fatalf("got %q", ref)
+	}
+	for _, f := range s.Fields {
+		if s.Definitions[f.Schema.Ref] == nil {
+			t.Fatalf("%s is not defined", f.Schema.Ref)
+		}
+	}
+}
@@ -0,0 +1,415 @@
+// Package schema validates raw msgpack data against shapes declared at
+// runtime, independently of Go struct definitions.
+//
+// Schemas can be built in Go or loaded from JSON:
+//
+//	{"type": "map", "fields": [
+//		{"name": "id", "required": true, "schema": {"type": "int", "min": 1}},
+//		{"name": "tags", "schema": {"type": "array", "elem": {"type": "string"}}}
+//	]}
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+// Type is a msgpack wire type.
+type Type string
+
+const (
+	Any    Type = "any"
+	Nil    Type = "nil"
+	Bool   Type = "bool"
+	Int    Type = "int"
+	Float  Type = "float"
+	String Type = "string"
+	Bytes  Type = "bytes"
+	Array  Type = "array"
+	Map    Type = "map"
+	Ext    Type = "ext"
+)
+
+var wireTypes = map[msgpack.Type]Type{
+	msgpack.NilType:    Nil,
+	msgpack.BoolType:   Bool,
+	msgpack.IntType:    Int,
+	msgpack.UintType:   Int,
+	msgpack.FloatType:  Float,
+	msgpack.StringType: String,
+	msgpack.BinaryType: Bytes,
+	msgpack.ArrayType:  Array,
+	msgpack.MapType:    Map,
+	msgpack.ExtType:    Ext,
+}
+
+// Schema describes the expected shape of a msgpack value.
+type Schema struct {
+	// Type is the expected wire type. Empty type matches any value.
+	// Float also matches integers.
+	Type Type `json:"type,omitempty"`
+	// Nullable allows nil in place of the value.
+	Nullable bool `json:"nullable,omitempty"`
+
+	// Min and Max limit values of numbers.
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+	// MinLen and MaxLen limit lengths of strings, bytes, arrays and maps.
+	MinLen *int `json:"min_len,omitempty"`
+	MaxLen *int `json:"max_len,omitempty"`
+
+	// Fields describes string keys of a map. Keys that are not listed
+	// are violations unless AllowExtra is set. For arrays Fields
+	// describes elements by position.
+	Fields     []*Field `json:"fields,omitempty"`
+	AllowExtra bool     `json:"allow_extra,omitempty"`
+
+	// Items describes array elements by position.
+	Items []*Schema `json:"items,omitempty"`
+	// Elem describes elements of arrays and values of maps
+	// not covered by Items and Fields.
+	Elem *Schema `json:"elem,omitempty"`
+
+	// ExtID documents the extension type id of ext values.
+	ExtID *int8 `json:"ext_id,omitempty"`
+
+	// Ref names a schema in Definitions of the top-level schema
+	// that is used in place of this one.
+	Ref         string             `json:"ref,omitempty"`
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+}
+
+// Field describes a map key.
+type Field struct {
+	Name     string  `json:"name"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema,omitempty"`
+	// Tag is the msgpack tag of the Go struct field the schema
+	// was generated from.
+	Tag string `json:"tag,omitempty"`
+}
+
+// Violation is a mismatch between data and a schema.
+type Violation struct {
+	// Path to the value, e.g. "items[1].name". Empty for the top-level value.
+	Path    string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// Error is returned when data does not match a schema.
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	ss := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		ss[i] = v.String()
+	}
+	return "msgpack: schema: " + strings.Join(ss, "; ")
+}
+
+// Validate checks that data holds a single value matching the schema.
+// It returns *Error listing all violations or a decoding error
+// if data is malformed.
+func (s *Schema) Validate(data []byte) error {
+	d := msgpack.NewDecoder(bytes.NewReader(data))
+	if err := s.ValidateDecoder(d); err != nil {
+		return err
+	}
+	if _, err := d.PeekCode(); err == nil {
+		return fmt.Errorf("msgpack: schema: unexpected data after the value")
+	}
+	return nil
+}
+
+// ValidateDecoder reads the next value from d and checks it against
+// the schema.
+func (s *Schema) ValidateDecoder(d *msgpack.Decoder) error {
+	v := &validator{d: d, defs: s.Definitions}
+	if err := v.validate(s, ""); err != nil {
+		return err
+	}
+	if len(v.violations) > 0 {
+		return &Error{Violations: v.violations}
+	}
+	return nil
+}
+
+// Unmarshal validates data and decodes it into v.
+func (s *Schema) Unmarshal(data []byte, v interface{}) error {
+	if err := s.Validate(data); err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(data, v)
+}
+
+type validator struct {
+	d          *msgpack.Decoder
+	defs       map[string]*Schema
+	violations []Violation
+}
+
+func (v *validator) addf(path, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(s *Schema, path string) error {
+	if s != nil && s.Ref != "" {
+		def, ok := v.defs[s.Ref]
+		if !ok {
+			return fmt.Errorf("msgpack: schema: undefined ref %q", s.Ref)
+		}
+		if s.Nullable && !def.Nullable {
+			nullable := *def
+			nullable.Nullable = true
+			def = &nullable
+		}
+		s = def
+	}
+
+	next, err := v.d.PeekNextType()
+	if err != nil {
+		return err
+	}
+	typ := wireTypes[next]
+
+	if s == nil || s.Type == "" || s.Type == Any {
+		return v.d.Skip()
+	}
+	if typ == Nil && s.Nullable {
+		return v.d.Skip()
+	}
+	if typ != s.Type && !(s.Type == Float && typ == Int) {
+		v.addf(path, "got %s, wanted %s", typ, s.Type)
+		return v.d.Skip()
+	}
+
+	switch s.Type {
+	case Int, Float:
+		return v.number(s, next, path)
+	case String:
+		str, err := v.d.DecodeString()
+		if err != nil {
+			return err
+		}
+		v.checkLen(s, len(str), path)
+		return nil
+	case Bytes:
+		n, err := v.d.DecodeBytesTo(ioutil.Discard)
+		if err != nil {
+			return err
+		}
+		v.checkLen(s, int(n), path)
+		return nil
+	case Array:
+		return v.array(s, path)
+	case Map:
+		return v.mapValue(s, path)
+	default:
+		return v.d.Skip()
+	}
+}
+
+func (v *validator) number(s *Schema, next msgpack.Type, path string) error {
+	var f float64
+	switch next {
+	case msgpack.UintType:
+		n, err := v.d.DecodeUint64()
+		if err != nil {
+			return err
+		}
+		f = float64(n)
+	case msgpack.FloatType:
+		n, err := v.d.DecodeFloat64()
+		if err != nil {
+			return err
+		}
+		f = n
+	default:
+		n, err := v.d.DecodeInt64()
+		if err != nil {
+			return err
+		}
+		f = float64(n)
+	}
+	if s.Min != nil && f < *s.Min {
+		v.addf(path, "%v is less than %v", f, *s.Min)
+	}
+	if s.Max != nil && f > *s.Max {
+		v.addf(path, "%v is greater than %v", f, *s.Max)
+	}
+	return nil
+}
+
+func (v *validator) checkLen(s *Schema, n int, path string) {
+	if s.MinLen != nil && n < *s.MinLen {
+		v.addf(path, "length %d is less than %d", n, *s.MinLen)
+	}
+	if s.MaxLen != nil && n > *s.MaxLen {
+		v.addf(path, "length %d is greater than %d", n, *s.MaxLen)
+	}
+}
+
+func (v *validator) array(s *Schema, path string) error {
+	n, err := v.d.DecodeArrayLen()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		n = 0
+	}
+	v.checkLen(s, n, path)
+	if len(s.Fields) > 0 {
+		return v.fieldsArray(s, n, path)
+	}
+	if len(s.Items) > 0 && s.Elem == nil && n > len(s.Items) {
+		v.addf(path, "got %d elements, wanted at most %d", n, len(s.Items))
+	}
+	for i := 0; i < n; i++ {
+		elem := s.Elem
+		if i < len(s.Items) {
+			elem = s.Items[i]
+		}
+		if err := v.validate(elem, path+"["+strconv.Itoa(i)+"]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldsArray validates array elements against fields by position.
+func (v *validator) fieldsArray(s *Schema, n int, path string) error {
+	if n > len(s.Fields) && !s.AllowExtra {
+		v.addf(path, "got %d elements, wanted at most %d", n, len(s.Fields))
+	}
+	for i := 0; i < n; i++ {
+		if i >= len(s.Fields) {
+			if err := v.validate(s.Elem, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := v.validate(s.Fields[i].Schema, joinPath(path, s.Fields[i].Name)); err != nil {
+			return err
+		}
+	}
+	for _, f := range s.Fields[min(n, len(s.Fields)):] {
+		if f.Required {
+			v.addf(joinPath(path, f.Name), "required element is missing")
+		}
+	}
+	return nil
+}
+
+func (v *validator) mapValue(s *Schema, path string) error {
+	n, err := v.d.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		n = 0
+	}
+	v.checkLen(s, n, path)
+
+	seen := make(map[string]bool, len(s.Fields))
+	for i := 0; i < n; i++ {
+		next, err := v.d.PeekNextType()
+		if err != nil {
+			return err
+		}
+		if next != msgpack.StringType && next != msgpack.ExtType {
+			if err := v.d.Skip(); err != nil {
+				return err
+			}
+			if err := v.nonStringKey(s, wireTypes[next], path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Ext keys are produced by Encoder.UseKeyDictionary.
+		// Other exts are skipped by DecodeString.
+		key, err := v.d.DecodeString()
+		if _, ok := err.(*msgpack.ExtKeyError); ok {
+			if err := v.nonStringKey(s, Ext, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		keyPath := joinPath(path, key)
+
+		f := s.field(key)
+		switch {
+		case f != nil:
+			seen[key] = true
+			err = v.validate(f.Schema, keyPath)
+		case len(s.Fields) > 0 && !s.AllowExtra:
+			v.addf(keyPath, "unexpected key")
+			err = v.d.Skip()
+		default:
+			err = v.validate(s.Elem, keyPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range s.Fields {
+		if f.Required && !seen[f.Name] {
+			v.addf(joinPath(path, f.Name), "required key is missing")
+		}
+	}
+	return nil
+}
+
+// nonStringKey validates the value of a map entry with
+// a non-string key. The key is already consumed.
+func (v *validator) nonStringKey(s *Schema, keyType Type, path string) error {
+	if len(s.Fields) > 0 {
+		v.addf(path, "got %s key, wanted string", keyType)
+		return v.d.Skip()
+	}
+	return v.validate(s.Elem, path+"[]")
+}
+
+func (s *Schema) field(name string) *Field {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func min(a, b int) int {
+	if a <= b {
+		return a
+	}
+	return b
+}
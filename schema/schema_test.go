@@ -0,0 +1,141 @@
+package schema_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+	"github.com/vmihailenco/msgpack/schema"
+)
+
+const userSchema = `{"type": "map", "fields": [
+	{"name": "id", "required": true, "schema": {"type": "int", "min": 1}},
+	{"name": "name", "required": true, "schema": {"type": "string", "max_len": 8}},
+	{"name": "score", "schema": {"type": "float", "nullable": true}},
+	{"name": "tags", "schema": {"type": "array", "elem": {"type": "string"}}}
+]}`
+
+func loadSchema(t *testing.T) *schema.Schema {
+	var s schema.Schema
+	if err := json.Unmarshal([]byte(userSchema), &s); err != nil {
+		t.Fatal(err)
+	}
+	return &s
+}
+
+func TestValidate(t *testing.T) {
+	s := loadSchema(t)
+
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"id":    1,
+		"name":  "alice",
+		"score": nil,
+		"tags":  []string{"a", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var user struct {
+		ID   int    `msgpack:"id"`
+		Name string `msgpack:"name"`
+	}
+	if err := s.Unmarshal(b, &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || user.Name != "alice" {
+		t.Fatalf("got %+v", user)
+	}
+}
+
+func TestValidateViolations(t *testing.T) {
+	s := loadSchema(t)
+
+	b, err := msgpack.Marshal(map[string]interface{}{
+		"id":    0,
+		"score": "high",
+		"tags":  []interface{}{"a", 2},
+		"extra": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Validate(b)
+	verr, ok := err.(*schema.Error)
+	if !ok {
+		t.Fatalf("got %v, wanted *schema.Error", err)
+	}
+
+	got := make(map[string]bool)
+	for _, v := range verr.Violations {
+		got[v.String()] = true
+	}
+	wanted := map[string]bool{
+		"id: 0 is less than 1":            true,
+		"score: got string, wanted float": true,
+		"tags[1]: got int, wanted string": true,
+		"extra: unexpected key":           true,
+		"name: required key is missing":   true,
+	}
+	if !reflect.DeepEqual(got, wanted) {
+		t.Fatalf("got %v, wanted %v", got, wanted)
+	}
+}
+
+func TestValidateKeyDictionary(t *testing.T) {
+	s := &schema.Schema{
+		Type: schema.Array,
+		Elem: loadSchema(t),
+	}
+
+	var users []map[string]interface{}
+	for i := 1; i <= 3; i++ {
+		users = append(users, map[string]interface{}{"id": i, "name": "bob"})
+	}
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).UseKeyDictionary(true).Encode(users); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateExtKey(t *testing.T) {
+	s := loadSchema(t)
+
+	b := []byte{
+		0x83,
+		0xd4, 0x05, 0x00, 0x01,
+		0xa2, 'i', 'd', 0x01,
+		0xa4, 'n', 'a', 'm', 'e', 0xa3, 'b', 'o', 'b',
+	}
+	err := s.Validate(b)
+	verr, ok := err.(*schema.Error)
+	if !ok {
+		t.Fatalf("got %v, wanted *schema.Error", err)
+	}
+	if len(verr.Violations) != 1 {
+		t.Fatalf("got %v", verr.Violations)
+	}
+	if got := verr.Violations[0].Message; got != "got ext key, wanted string" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	s := loadSchema(t)
+	err := s.Validate([]byte{0x81, 0xa2, 'i'})
+	if err == nil {
+		t.Fatal("got nil error")
+	}
+	if _, ok := err.(*schema.Error); ok {
+		t.Fatalf("got %v, wanted decoding error", err)
+	}
+}
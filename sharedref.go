@@ -0,0 +1,192 @@
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// Ext ids used to encode shared references. A pointer is encoded
+// the first time as a definition, i.e. ext with the encoded value as the
+// body, and then as a reference, i.e. fixext4 with the index of
+// the definition.
+var sharedDefExtId int8 = -122
+var sharedRefExtId int8 = -123
+
+var errNoPeeker = errors.New("msgpack: shared refs require the reader to implement Peek")
+
+type peeker interface {
+	Peek(n int) ([]byte, error)
+}
+
+// UseSharedRefs causes the Encoder to encode each pointer only once
+// and to encode repeated occurrences of the same pointer as references
+// to the first one. It preserves pointer identity and allows encoding
+// cyclic values. References are resolved across all values encoded by
+// the Encoder, so the values must be decoded in the same order by a single
+// Decoder with UseSharedRefs enabled. Enabling the option resets
+// remembered pointers.
+func (e *Encoder) UseSharedRefs(v bool) *Encoder {
+	e.sharedRefs = v
+	e.refs = nil
+	return e
+}
+
+// UseSharedRefs causes the Decoder to decode references encoded by
+// the Encoder with UseSharedRefs enabled into shared pointers.
+// If the reader does not implement Peek it is wrapped with bufio.Reader.
+// Enabling the option resets remembered pointers.
+func (d *Decoder) UseSharedRefs(v bool) *Decoder {
+	d.sharedRefs = v
+	d.refs = nil
+	if v {
+		d.ensurePeeker()
+	}
+	return d
+}
+
+// ensurePeeker wraps the underlying reader with bufio.Reader
+// if it does not implement Peek.
+func (d *Decoder) ensurePeeker() {
+	if l, ok := d.r.(*sizeLimiter); ok {
+		if _, ok := l.r.(peeker); !ok {
+			l.r = bufio.NewReader(l.r)
+		}
+		return
+	}
+	if _, ok := d.r.(peeker); !ok {
+		d.r = bufio.NewReader(d.r)
+	}
+}
+
+// encodeSharedRef encodes a reference to pointer v if it was encoded
+// before. Otherwise it encodes a definition with the value encoded by
+// encoder as the ext body.
+func (e *Encoder) encodeSharedRef(v reflect.Value, encoder encoderFunc) error {
+	key := newVisitKey(v)
+	if idx, ok := e.refs[key]; ok {
+		if err := e.writeCode(codes.FixExt4); err != nil {
+			return err
+		}
+		if err := e.w.WriteByte(byte(sharedRefExtId)); err != nil {
+			return err
+		}
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(idx))
+		return e.write(b[:])
+	}
+
+	if e.refs == nil {
+		e.refs = make(map[visitKey]int)
+	}
+	e.refs[key] = len(e.refs)
+	return e.encodeExt(sharedDefExtId, func(e *Encoder) error {
+		return encoder(e, v.Elem())
+	})
+}
+
+// decodeSharedRef decodes a definition or a reference into pointer v
+// and returns true. It returns false if the next value is neither.
+func (d *Decoder) decodeSharedRef(v reflect.Value, decoder decoderFunc) (bool, error) {
+	p, ok := d.r.(peeker)
+	if !ok {
+		return true, errNoPeeker
+	}
+	// Peek only as many bytes as the ext header has, because
+	// a short value may be the last one available.
+	b, err := p.Peek(1)
+	if err == errNoPeeker {
+		return true, err
+	}
+	if len(b) == 0 || !codes.IsExt(codes.Code(b[0])) {
+		return false, nil
+	}
+	n := 1 + extHeaderLen(codes.Code(b[0]))
+	b, _ = p.Peek(n + 1)
+	if len(b) <= n {
+		return false, nil
+	}
+
+	switch int8(b[n]) {
+	case sharedDefExtId:
+		if err := d.skipN(n + 1); err != nil {
+			return true, err
+		}
+		if v.IsNil() {
+			if !v.CanSet() {
+				return true, fmt.Errorf("msgpack: Decode(nonsettable %T)", v.Interface())
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		// Remember the pointer before decoding the value to support cycles.
+		d.refs = append(d.refs, v.Interface())
+		return true, decoder(d, v.Elem())
+	case sharedRefExtId:
+		if codes.Code(b[0]) != codes.FixExt4 {
+			return true, fmt.Errorf("msgpack: invalid code=%x decoding shared ref", b[0])
+		}
+		if err := d.skipN(n + 1); err != nil {
+			return true, err
+		}
+		ref, err := d.sharedRef()
+		if err != nil {
+			return true, err
+		}
+		refv := reflect.ValueOf(ref)
+		if refv.Type() != v.Type() {
+			return true, fmt.Errorf("msgpack: shared ref has type %s, wanted %s", refv.Type(), v.Type())
+		}
+		if v.CanSet() {
+			v.Set(refv)
+		} else {
+			v.Elem().Set(refv.Elem())
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (d *Decoder) sharedRef() (interface{}, error) {
+	idx, err := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if int(idx) >= len(d.refs) {
+		return nil, fmt.Errorf("msgpack: invalid shared ref=%d", idx)
+	}
+	ref := d.refs[idx]
+	if _, ok := ref.(pendingRef); ok {
+		return nil, fmt.Errorf("msgpack: can't decode cyclic shared ref=%d into interface{}", idx)
+	}
+	return ref, nil
+}
+
+// pendingRef is a placeholder for a value being decoded into interface{}.
+type pendingRef struct{}
+
+// decodeSharedDefInterface decodes the body of a shared ref definition
+// when decoding into interface{}. The ext header is already read.
+func (d *Decoder) decodeSharedDefInterface() (interface{}, error) {
+	idx := len(d.refs)
+	d.refs = append(d.refs, pendingRef{})
+	v, err := d.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	d.refs[idx] = v
+	return v, nil
+}
+
+// decodeSharedRefInterface decodes a shared ref when decoding
+// into interface{}. The ext header is already read.
+func (d *Decoder) decodeSharedRefInterface(extLen int) (interface{}, error) {
+	if extLen != 4 {
+		return nil, fmt.Errorf("msgpack: invalid ext len=%d decoding shared ref", extLen)
+	}
+	return d.sharedRef()
+}
@@ -0,0 +1,156 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type graphNode struct {
+	Name  string
+	Edges []*graphNode
+	Attrs map[string]interface{}
+}
+
+func TestSharedRefs(t *testing.T) {
+	shared := &graphNode{Name: "shared"}
+	root := &graphNode{
+		Name:  "root",
+		Edges: []*graphNode{shared, shared},
+		Attrs: map[string]interface{}{"n": 1},
+	}
+	shared.Edges = []*graphNode{root}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf).UseSharedRefs(true)
+	if err := enc.Encode(root, shared, "end"); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(buf.Bytes())).UseSharedRefs(true)
+	var out *graphNode
+	var out2 *graphNode
+	var end string
+	if err := dec.Decode(&out, &out2, &end); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Name != "root" || len(out.Edges) != 2 || end != "end" {
+		t.Fatalf("got %#v", out)
+	}
+	if out.Edges[0] != out.Edges[1] {
+		t.Fatalf("shared pointers are not preserved")
+	}
+	if out.Edges[0].Edges[0] != out {
+		t.Fatalf("cycle is not preserved")
+	}
+	if out2 != out.Edges[0] {
+		t.Fatalf("refs are not shared between values")
+	}
+
+	var iface interface{}
+	dec = msgpack.NewDecoder(bytes.NewReader(buf.Bytes())).UseSharedRefs(true)
+	err := dec.Decode(&iface)
+	wanted := "msgpack: can't decode cyclic shared ref=0 into interface{}"
+	if err == nil || err.Error() != wanted {
+		t.Fatalf("got %v, wanted %q", err, wanted)
+	}
+
+	dec = msgpack.NewDecoder(bytes.NewReader(buf.Bytes()))
+	if err := dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Skip(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&end); err != nil {
+		t.Fatal(err)
+	}
+	if end != "end" {
+		t.Fatalf("got %q, wanted end", end)
+	}
+}
+
+func TestSharedRefsInterface(t *testing.T) {
+	shared := &graphNode{Name: "shared"}
+	in := []*graphNode{shared, shared}
+
+	b, err := marshalSharedRefs(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []interface{}
+	dec := msgpack.NewDecoder(bytes.NewReader(b)).UseSharedRefs(true)
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("got %d elements, wanted 2", len(out))
+	}
+	m1, m2 := out[0].(map[string]interface{}), out[1].(map[string]interface{})
+	if m1["Name"] != "shared" || m2["Name"] != "shared" {
+		t.Fatalf("got %v", out)
+	}
+}
+
+func marshalSharedRefs(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := msgpack.NewEncoder(&buf).UseSharedRefs(true).Encode(v)
+	return buf.Bytes(), err
+}
+
+func TestSharedRefsSpecCompliant(t *testing.T) {
+	shared := &graphNode{Name: "shared"}
+	b, err := marshalSharedRefs([]*graphNode{shared, shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Definitions carry the value as the ext body, so decoders that
+	// don't know the ext see exactly 2 elements.
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	n, err := dec.DecodeArrayLen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := dec.Skip(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dec.PeekCode(); err != io.EOF {
+		t.Fatalf("got %v, wanted io.EOF", err)
+	}
+
+	d := msgpack.NewPushDecoder()
+	msgs, err := d.Feed(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || !bytes.Equal(msgs[0], b) {
+		t.Fatalf("got %x, wanted %x", msgs, b)
+	}
+}
+
+func TestSharedRefsReset(t *testing.T) {
+	n := 42
+	b, err := marshalSharedRefs(struct{ P *int }{&n})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b)).UseSharedRefs(true)
+	if err := dec.Reset(bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+	var out struct{ P *int }
+	if err := dec.Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.P == nil || *out.P != 42 {
+		t.Fatalf("got %v", out.P)
+	}
+}
@@ -0,0 +1,288 @@
+package msgpack
+
+import (
+	"math"
+	"reflect"
+)
+
+// SizeOf returns the length of MessagePack encoding of v with the default
+// Encoder options. Sizes of numbers, strings, bytes, slices, arrays, maps,
+// pointers and structs are computed from their values and lengths without
+// encoding them. Values that implement Sizer report their size themselves.
+// Other values with custom encoding, e.g. registered types, are encoded
+// into a writer that only counts bytes.
+func SizeOf(v interface{}) (int, error) {
+	if v == nil {
+		return 1, nil
+	}
+	var s sizer
+	return s.size(reflect.ValueOf(v))
+}
+
+// sizer walks values computing the length of their encoding.
+type sizer struct {
+	custom map[reflect.Type]bool
+
+	w   countingWriter
+	enc *Encoder
+}
+
+func (s *sizer) size(v reflect.Value) (int, error) {
+	if s.hasCustomEncoding(v.Type()) {
+		return s.encoded((*Encoder).EncodeValue, v)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return 1, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intSize(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return uintSize(v.Uint()), nil
+	case reflect.Float32:
+		return 5, nil
+	case reflect.Float64:
+		return 9, nil
+	case reflect.String:
+		return strLenSize(v.Len()) + v.Len(), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return 1, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return binLenSize(v.Len()) + v.Len(), nil
+		}
+		return s.arraySize(v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return binLenSize(v.Len()) + v.Len(), nil
+		}
+		return s.arraySize(v)
+	case reflect.Map:
+		return s.mapSize(v)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return 1, nil
+		}
+		return s.size(v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			return 1, nil
+		}
+		if _, ok := typeName(v.Elem().Type()); ok {
+			return s.encoded((*Encoder).EncodeValue, v)
+		}
+		return s.size(v.Elem())
+	case reflect.Struct:
+		return s.structSize(v)
+	}
+	// Let the encoder report unsupported values.
+	return s.encoded((*Encoder).EncodeValue, v)
+}
+
+func (s *sizer) arraySize(v reflect.Value) (int, error) {
+	n := containerLenSize(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		m, err := s.size(v.Index(i))
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+func (s *sizer) mapSize(v reflect.Value) (int, error) {
+	if v.IsNil() {
+		return 1, nil
+	}
+	keyType := v.Type().Key()
+	structKeys := keyType.Kind() == reflect.Struct && !s.hasCustomEncoding(keyType)
+
+	n := containerLenSize(v.Len())
+	for _, key := range v.MapKeys() {
+		var m int
+		var err error
+		if structKeys {
+			m, err = s.fieldsSize(key, structs.Fields(keyType).List)
+		} else {
+			m, err = s.size(key)
+		}
+		if err != nil {
+			return 0, err
+		}
+		n += m
+
+		m, err = s.size(v.MapIndex(key))
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+func (s *sizer) structSize(strct reflect.Value) (int, error) {
+	fs := structs.Fields(strct.Type())
+	if fs.asArray {
+		return s.fieldsSize(strct, fs.List)
+	}
+	if fs.idErr != nil {
+		return 0, fs.idErr
+	}
+
+	var n, count int
+	for _, f := range fs.List {
+		if fs.omitEmpty && f.Omit(strct) {
+			continue
+		}
+		m, err := s.fieldSize(f, strct)
+		if err != nil {
+			return 0, err
+		}
+		n += len(f.encodedName) + m
+		count++
+	}
+	return containerLenSize(count) + n, nil
+}
+
+// fieldsSize returns the size of struct fields encoded as an array.
+func (s *sizer) fieldsSize(strct reflect.Value, list []*field) (int, error) {
+	n := containerLenSize(len(list))
+	for _, f := range list {
+		m, err := s.fieldSize(f, strct)
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+func (s *sizer) fieldSize(f *field, strct reflect.Value) (int, error) {
+	if f.fixedInt {
+		return s.encoded(f.encoder, f.value(strct))
+	}
+	return s.size(f.value(strct))
+}
+
+// encoded returns the size of v encoded by fn.
+func (s *sizer) encoded(fn encoderFunc, v reflect.Value) (int, error) {
+	if s.enc == nil {
+		s.enc = NewEncoder(&s.w)
+	}
+	s.w.n = 0
+	err := fn(s.enc, v)
+	return s.w.n, err
+}
+
+// hasCustomEncoding reports whether values of typ are not encoded
+// by the default encoders of their kind.
+func (s *sizer) hasCustomEncoding(typ reflect.Type) bool {
+	if custom, ok := s.custom[typ]; ok {
+		return custom
+	}
+	custom := typ == errorType || HasCustomEncoding(typ)
+	if s.custom == nil {
+		s.custom = make(map[reflect.Type]bool)
+	}
+	s.custom[typ] = custom
+	return custom
+}
+
+func uintSize(n uint64) int {
+	switch {
+	case n <= math.MaxInt8:
+		return 1
+	case n <= math.MaxUint8:
+		return 2
+	case n <= math.MaxUint16:
+		return 3
+	case n <= math.MaxUint32:
+		return 5
+	}
+	return 9
+}
+
+func intSize(n int64) int {
+	switch {
+	case n >= 0:
+		return uintSize(uint64(n))
+	case n >= -32:
+		return 1
+	case n >= math.MinInt8:
+		return 2
+	case n >= math.MinInt16:
+		return 3
+	case n >= math.MinInt32:
+		return 5
+	}
+	return 9
+}
+
+func strLenSize(n int) int {
+	switch {
+	case n < 32:
+		return 1
+	case n <= math.MaxUint8:
+		return 2
+	case n <= math.MaxUint16:
+		return 3
+	}
+	return 5
+}
+
+func binLenSize(n int) int {
+	switch {
+	case n <= math.MaxUint8:
+		return 2
+	case n <= math.MaxUint16:
+		return 3
+	}
+	return 5
+}
+
+func containerLenSize(n int) int {
+	switch {
+	case n < 16:
+		return 1
+	case n <= math.MaxUint16:
+		return 3
+	}
+	return 5
+}
+
+// countingWriter discards written data counting its length.
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.n += len(b)
+	return len(b), nil
+}
+
+func (w *countingWriter) WriteByte(byte) error {
+	w.n++
+	return nil
+}
+
+func (w *countingWriter) WriteString(s string) (int, error) {
+	w.n += len(s)
+	return len(s), nil
+}
+
+// encodeSize reports the size of v if the Encoder only counts the size
+// and v implements Sizer.
+func (e *Encoder) encodeSize(v reflect.Value) bool {
+	w, ok := e.w.(*countingWriter)
+	if !ok {
+		return false
+	}
+	sizer, ok := v.Interface().(Sizer)
+	if !ok {
+		return false
+	}
+	w.n += sizer.MsgpackSize()
+	return true
+}
@@ -0,0 +1,197 @@
+package msgpack
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// Stats holds counters collected by an Encoder or a Decoder with enabled
+// stats. Values, types and time are counted for values passed to Encode
+// and Decode; bytes are counted for all data written or read.
+type Stats struct {
+	// Values is the number of encoded or decoded values.
+	Values int64
+	// Errors is the number of values that failed to encode or decode.
+	Errors int64
+	// Bytes is the number of bytes written or read.
+	Bytes int64
+	// Duration is the time spent encoding or decoding values.
+	Duration time.Duration
+	// WireTypes counts values by the MessagePack type they are encoded as.
+	WireTypes map[Type]int64
+	// GoTypes counts values by their Go type. Decoder counts the type
+	// pointed to by the Decode argument.
+	GoTypes map[reflect.Type]int64
+}
+
+func (s *Stats) clone() Stats {
+	c := *s
+	c.WireTypes = make(map[Type]int64, len(s.WireTypes))
+	for k, v := range s.WireTypes {
+		c.WireTypes[k] = v
+	}
+	c.GoTypes = make(map[reflect.Type]int64, len(s.GoTypes))
+	for k, v := range s.GoTypes {
+		c.GoTypes[k] = v
+	}
+	return c
+}
+
+// statsCollector accumulates Stats of an Encoder or a Decoder.
+type statsCollector struct {
+	stats Stats
+
+	// first is set while waiting for the first byte of a value,
+	// which is the code of its wire type.
+	first bool
+	code  byte
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		stats: Stats{
+			WireTypes: make(map[Type]int64),
+			GoTypes:   make(map[reflect.Type]int64),
+		},
+	}
+}
+
+func (c *statsCollector) bytes(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	c.stats.Bytes += int64(len(b))
+	if c.first {
+		c.first = false
+		c.code = b[0]
+	}
+}
+
+func (c *statsCollector) byte(b byte) {
+	c.stats.Bytes++
+	if c.first {
+		c.first = false
+		c.code = b
+	}
+}
+
+func (c *statsCollector) begin() time.Time {
+	c.first = true
+	return time.Now()
+}
+
+func (c *statsCollector) end(start time.Time, typ reflect.Type, err error) {
+	c.stats.Duration += time.Since(start)
+	if err != nil {
+		c.stats.Errors++
+		return
+	}
+	c.stats.Values++
+	if !c.first {
+		c.stats.WireTypes[codeType(codes.Code(c.code))]++
+	}
+	c.first = false
+	if typ != nil {
+		c.stats.GoTypes[typ]++
+	}
+}
+
+// EnableStats causes the Encoder to collect Stats. EnableStats(false)
+// stops collecting and drops the collected stats.
+func (e *Encoder) EnableStats(v bool) *Encoder {
+	if sw, ok := e.w.(*statsWriter); ok {
+		e.w = sw.w
+	}
+	e.stats = nil
+	if v {
+		e.stats = newStatsCollector()
+		e.w = &statsWriter{w: e.w, c: e.stats}
+	}
+	return e
+}
+
+// Stats returns a copy of the stats collected since stats were enabled
+// or reset.
+func (e *Encoder) Stats() Stats {
+	if e.stats == nil {
+		return Stats{}
+	}
+	return e.stats.stats.clone()
+}
+
+// ResetStats zeroes the collected stats.
+func (e *Encoder) ResetStats() {
+	if e.stats != nil {
+		e.stats.stats = newStatsCollector().stats
+	}
+}
+
+// decodedType returns the type pointed to by the Decode argument v.
+func decodedType(v interface{}) reflect.Type {
+	typ := reflect.TypeOf(v)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+// statsWriter counts bytes written by the Encoder.
+type statsWriter struct {
+	w writer
+	c *statsCollector
+}
+
+func (w *statsWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.c.bytes(b[:n])
+	return n, err
+}
+
+func (w *statsWriter) WriteByte(b byte) error {
+	if err := w.w.WriteByte(b); err != nil {
+		return err
+	}
+	w.c.byte(b)
+	return nil
+}
+
+func (w *statsWriter) WriteString(s string) (int, error) {
+	n, err := w.w.WriteString(s)
+	if n > 0 {
+		w.c.stats.Bytes += int64(n)
+		if w.c.first {
+			w.c.first = false
+			w.c.code = s[0]
+		}
+	}
+	return n, err
+}
+
+// EnableStats causes the Decoder to collect Stats. EnableStats(false)
+// stops collecting and drops the collected stats.
+func (d *Decoder) EnableStats(v bool) *Decoder {
+	d.stats = nil
+	if v {
+		d.stats = newStatsCollector()
+	}
+	d.wrapReader()
+	return d
+}
+
+// Stats returns a copy of the stats collected since stats were enabled
+// or reset.
+func (d *Decoder) Stats() Stats {
+	if d.stats == nil {
+		return Stats{}
+	}
+	return d.stats.stats.clone()
+}
+
+// ResetStats zeroes the collected stats.
+func (d *Decoder) ResetStats() {
+	if d.stats != nil {
+		d.stats.stats = newStatsCollector().stats
+	}
+}
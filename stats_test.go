@@ -0,0 +1,79 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type statsItem struct {
+	Name string
+}
+
+func TestEncoderStats(t *testing.T) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf).EnableStats(true)
+	if err := enc.Encode("foo", 1, statsItem{Name: "a"}, &statsItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(make(chan int)); err == nil {
+		t.Fatal("got nil error")
+	}
+
+	stats := enc.Stats()
+	if stats.Values != 4 || stats.Errors != 1 {
+		t.Fatalf("got %d values and %d errors", stats.Values, stats.Errors)
+	}
+	if stats.Bytes != int64(buf.Len()) {
+		t.Fatalf("got %d bytes, wanted %d", stats.Bytes, buf.Len())
+	}
+	wire := map[msgpack.Type]int64{
+		msgpack.StringType: 1,
+		msgpack.UintType:   1,
+		msgpack.MapType:    2,
+	}
+	if !reflect.DeepEqual(stats.WireTypes, wire) {
+		t.Fatalf("got %v, wanted %v", stats.WireTypes, wire)
+	}
+	if n := stats.GoTypes[reflect.TypeOf(statsItem{})]; n != 1 {
+		t.Fatalf("got %d statsItem values, wanted 1", n)
+	}
+
+	enc.ResetStats()
+	if stats := enc.Stats(); stats.Values != 0 || stats.Bytes != 0 {
+		t.Fatalf("got %+v after reset", stats)
+	}
+}
+
+func TestDecoderStats(t *testing.T) {
+	b, err := msgpack.Marshal("foo", statsItem{Name: "a"}, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(b)).EnableStats(true)
+	var s string
+	var item statsItem
+	var ints []int
+	if err := dec.Decode(&s, &item, &ints); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := dec.Stats()
+	if stats.Values != 3 || stats.Bytes != int64(len(b)) {
+		t.Fatalf("got %d values and %d bytes, wanted 3 and %d", stats.Values, stats.Bytes, len(b))
+	}
+	wire := map[msgpack.Type]int64{
+		msgpack.StringType: 1,
+		msgpack.MapType:    1,
+		msgpack.ArrayType:  1,
+	}
+	if !reflect.DeepEqual(stats.WireTypes, wire) {
+		t.Fatalf("got %v, wanted %v", stats.WireTypes, wire)
+	}
+	if n := stats.GoTypes[reflect.TypeOf(statsItem{})]; n != 1 {
+		t.Fatalf("got %d statsItem values, wanted 1", n)
+	}
+}
@@ -0,0 +1,62 @@
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ArrayStream encodes an array whose length is not known in advance.
+// It is created by Encoder.EncodeArrayStream.
+type ArrayStream struct {
+	e      *Encoder
+	buf    bytes.Buffer
+	n      int
+	closed bool
+}
+
+// EncodeArrayStream starts encoding an array whose elements are added
+// with Append. Elements are buffered and the array is written when
+// the stream is closed, because the array header holds the number
+// of elements. The Encoder must not be used until the stream is closed.
+func (e *Encoder) EncodeArrayStream() *ArrayStream {
+	return &ArrayStream{e: e}
+}
+
+// Append encodes v as the next array element. If v fails to encode,
+// nothing is appended.
+func (s *ArrayStream) Append(v interface{}) error {
+	if s.closed {
+		return errors.New("msgpack: Append on closed ArrayStream")
+	}
+	n := s.buf.Len()
+	w := s.e.w
+	s.e.w = &s.buf
+	err := s.e.Encode(v)
+	s.e.w = w
+	if err != nil {
+		// Drop the partially encoded element.
+		s.buf.Truncate(n)
+		return err
+	}
+	s.n++
+	return nil
+}
+
+// Len returns the number of appended elements.
+func (s *ArrayStream) Len() int {
+	return s.n
+}
+
+// Close writes the array header followed by the appended elements.
+func (s *ArrayStream) Close() error {
+	if s.closed {
+		return errors.New("msgpack: ArrayStream is already closed")
+	}
+	s.closed = true
+	if err := s.e.EncodeArrayLen(s.n); err != nil {
+		return err
+	}
+	err := s.e.write(s.buf.Bytes())
+	s.buf = bytes.Buffer{}
+	return err
+}
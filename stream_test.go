@@ -0,0 +1,85 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func TestArrayStream(t *testing.T) {
+	ch := make(chan map[string]interface{}, 20)
+	for i := 0; i < 20; i++ {
+		ch <- map[string]interface{}{"id": i, "name": "item"}
+	}
+	close(ch)
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf).UseKeyDictionary(true)
+	s := enc.EncodeArrayStream()
+	for item := range ch {
+		if err := s.Append(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("got %d bytes written before Close", buf.Len())
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(1); err == nil {
+		t.Fatal("got nil error appending to closed stream")
+	}
+	if err := enc.Encode("after"); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := msgpack.NewDecoder(&buf)
+	var items []map[string]interface{}
+	var after string
+	if err := dec.Decode(&items, &after); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 20 || after != "after" {
+		t.Fatalf("got %d items and %q", len(items), after)
+	}
+	if !reflect.DeepEqual(items[7], map[string]interface{}{"id": int64(7), "name": "item"}) {
+		t.Fatalf("got %v", items[7])
+	}
+}
+
+func TestArrayStreamEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).EncodeArrayStream().Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0x90}) {
+		t.Fatalf("got %x, wanted 90", buf.Bytes())
+	}
+}
+
+func TestArrayStreamAppendError(t *testing.T) {
+	var buf bytes.Buffer
+	s := msgpack.NewEncoder(&buf).EncodeArrayStream()
+	if err := s.Append(1); err != nil {
+		t.Fatal(err)
+	}
+	bad := struct {
+		A int
+		C chan int
+	}{A: 1}
+	if err := s.Append(bad); err == nil {
+		t.Fatal("got nil error appending unsupported value")
+	}
+	if err := s.Append(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0x92, 0x01, 0x02}) {
+		t.Fatalf("got %x, wanted 920102", buf.Bytes())
+	}
+}
@@ -3,20 +3,58 @@ package msgpack
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/vmihailenco/msgpack/codes"
 )
 
 var timeExtId int8 = -1
+var zonedTimeExtId int8 = -124
 
 func init() {
 	timeType := reflect.TypeOf((*time.Time)(nil)).Elem()
-	registerExt(timeExtId, timeType, encodeTimeValue, decodeTimeValue)
+	registerBuiltin(timeType, encodeTimeValue, decodeTimeValue)
+}
+
+// UseRFC3339Time causes the Encoder to encode time.Time as a string
+// in RFC3339 format with nanoseconds instead of ext, which is friendlier
+// to JSON gateways and log pipelines. Decoder accepts such strings
+// when decoding time.Time.
+func (e *Encoder) UseRFC3339Time(v bool) *Encoder {
+	e.useRFC3339Time = v
+	return e
+}
+
+// UseZonedTime causes the Encoder to encode time.Time together with
+// its zone offset and location name, so decoded times have the same
+// wall clock and location, e.g. Asia/Shanghai. Times are encoded as ext
+// with 8 bytes of seconds, 4 bytes of nanoseconds, 4 bytes of zone
+// offset in seconds and the location name.
+func (e *Encoder) UseZonedTime(v bool) *Encoder {
+	e.useZonedTime = v
+	return e
 }
 
 func (e *Encoder) EncodeTime(tm time.Time) error {
+	if e.useRFC3339Time {
+		return e.EncodeString(tm.Format(time.RFC3339Nano))
+	}
+	if e.compatibleEncoding {
+		if err := e.EncodeArrayLen(2); err != nil {
+			return err
+		}
+		if err := e.EncodeInt(tm.Unix()); err != nil {
+			return err
+		}
+		return e.EncodeInt(int64(tm.Nanosecond()))
+	}
+	if e.useZonedTime {
+		return e.encodeZonedTime(tm)
+	}
+
 	b := e.encodeTime(tm)
 	if err := e.encodeExtLen(len(b)); err != nil {
 		return err
@@ -54,6 +92,34 @@ func (d *Decoder) DecodeTime() (time.Time, error) {
 		return time.Time{}, err
 	}
 
+	if isStringCode(c) {
+		s, err := d.string(c)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	}
+
+	if d.tolerantTime {
+		switch {
+		case c == codes.Nil:
+			return time.Time{}, nil
+		case isIntCode(c):
+			sec, err := d.int(c)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(sec, 0), nil
+		case c == codes.Float || c == codes.Double:
+			f, err := d.float64(c)
+			if err != nil {
+				return time.Time{}, err
+			}
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(frac*1e9)), nil
+		}
+	}
+
 	// Legacy format.
 	if c == codes.FixedArrayLow|2 {
 		sec, err := d.DecodeInt64()
@@ -72,16 +138,24 @@ func (d *Decoder) DecodeTime() (time.Time, error) {
 		return time.Time{}, err
 	}
 
-	_, err = d.r.ReadByte()
+	extId, err := d.r.ReadByte()
 	if err != nil {
-		return time.Time{}, nil
+		return time.Time{}, err
 	}
 
+	return d.time(int8(extId), extLen)
+}
+
+func (d *Decoder) time(extId int8, extLen int) (time.Time, error) {
 	b, err := d.readN(extLen)
 	if err != nil {
 		return time.Time{}, err
 	}
 
+	if extId == zonedTimeExtId {
+		return decodeZonedTime(b)
+	}
+
 	switch len(b) {
 	case 4:
 		sec := binary.BigEndian.Uint32(b)
@@ -100,12 +174,78 @@ func (d *Decoder) DecodeTime() (time.Time, error) {
 	}
 }
 
-func encodeTimeValue(e *Encoder, v reflect.Value) error {
-	tm := v.Interface().(time.Time)
-	b := e.encodeTime(tm)
+func (e *Encoder) encodeZonedTime(tm time.Time) error {
+	name := tm.Location().String()
+	_, offset := tm.Zone()
+
+	b := make([]byte, 16, 16+len(name))
+	binary.BigEndian.PutUint64(b, uint64(tm.Unix()))
+	binary.BigEndian.PutUint32(b[8:], uint32(tm.Nanosecond()))
+	binary.BigEndian.PutUint32(b[12:], uint32(int32(offset)))
+	b = append(b, name...)
+
+	if err := e.encodeExtLen(len(b)); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(byte(zonedTimeExtId)); err != nil {
+		return err
+	}
 	return e.write(b)
 }
 
+func decodeZonedTime(b []byte) (time.Time, error) {
+	if len(b) < 16 {
+		return time.Time{}, fmt.Errorf("msgpack: invalid ext len=%d decoding time", len(b))
+	}
+	sec := int64(binary.BigEndian.Uint64(b))
+	nsec := int64(binary.BigEndian.Uint32(b[8:]))
+	offset := int(int32(binary.BigEndian.Uint32(b[12:])))
+	name := string(b[16:])
+
+	tm := time.Unix(sec, nsec)
+	if loc, err := loadLocation(name); err == nil {
+		// Use the location only if it agrees with the encoded offset,
+		// e.g. Local may differ between machines.
+		if _, off := tm.In(loc).Zone(); off == offset {
+			return tm.In(loc), nil
+		}
+	}
+	return tm.In(time.FixedZone(name, offset)), nil
+}
+
+var locations = struct {
+	sync.RWMutex
+	m map[string]*time.Location
+}{
+	m: make(map[string]*time.Location),
+}
+
+// loadLocation is time.LoadLocation that caches loaded locations,
+// because loading reads the time zone database every time.
+// sync.Map is not used to keep supporting Go 1.7.
+func loadLocation(name string) (*time.Location, error) {
+	locations.RLock()
+	loc, ok := locations.m[name]
+	locations.RUnlock()
+	if ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locations.Lock()
+	locations.m[name] = loc
+	locations.Unlock()
+	return loc, nil
+}
+
+func encodeTimeValue(e *Encoder, v reflect.Value) error {
+	return e.EncodeTime(v.Interface().(time.Time))
+}
+
 func decodeTimeValue(d *Decoder, v reflect.Value) error {
 	tm, err := d.DecodeTime()
 	if err != nil {
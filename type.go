@@ -0,0 +1,99 @@
+package msgpack
+
+import (
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+// Type is the type of an encoded MessagePack value.
+type Type int
+
+const (
+	InvalidType Type = iota
+	NilType
+	BoolType
+	// IntType is a negative fixnum or a signed integer.
+	IntType
+	// UintType is a positive fixnum or an unsigned integer.
+	UintType
+	FloatType
+	StringType
+	BinaryType
+	ArrayType
+	MapType
+	ExtType
+)
+
+var typeStrings = [...]string{
+	InvalidType: "invalid",
+	NilType:     "nil",
+	BoolType:    "bool",
+	IntType:     "int",
+	UintType:    "uint",
+	FloatType:   "float",
+	StringType:  "string",
+	BinaryType:  "binary",
+	ArrayType:   "array",
+	MapType:     "map",
+	ExtType:     "ext",
+}
+
+func (t Type) String() string {
+	if t >= 0 && int(t) < len(typeStrings) {
+		return typeStrings[t]
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// PeekNextType returns the type of the next value without advancing
+// the reader.
+func (d *Decoder) PeekNextType() (Type, error) {
+	c, err := d.PeekCode()
+	if err != nil {
+		return InvalidType, err
+	}
+	typ := codeType(c)
+	if typ == InvalidType {
+		return typ, fmt.Errorf("msgpack: invalid code=%x", c)
+	}
+	return typ, nil
+}
+
+func codeType(c codes.Code) Type {
+	switch {
+	case c <= codes.PosFixedNumHigh:
+		return UintType
+	case c >= codes.NegFixedNumLow:
+		return IntType
+	case codes.IsFixedMap(c):
+		return MapType
+	case codes.IsFixedArray(c):
+		return ArrayType
+	case codes.IsFixedString(c):
+		return StringType
+	case codes.IsExt(c):
+		return ExtType
+	}
+	switch c {
+	case codes.Nil:
+		return NilType
+	case codes.False, codes.True:
+		return BoolType
+	case codes.Uint8, codes.Uint16, codes.Uint32, codes.Uint64:
+		return UintType
+	case codes.Int8, codes.Int16, codes.Int32, codes.Int64:
+		return IntType
+	case codes.Float, codes.Double:
+		return FloatType
+	case codes.Str8, codes.Str16, codes.Str32:
+		return StringType
+	case codes.Bin8, codes.Bin16, codes.Bin32:
+		return BinaryType
+	case codes.Array16, codes.Array32:
+		return ArrayType
+	case codes.Map16, codes.Map32:
+		return MapType
+	}
+	return InvalidType
+}
@@ -1,8 +1,14 @@
 package msgpack
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var errorType = reflect.TypeOf((*error)(nil)).Elem()
@@ -16,65 +22,351 @@ var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
 type encoderFunc func(*Encoder, reflect.Value) error
 type decoderFunc func(*Decoder, reflect.Value) error
 
+// typesMu protects registered types.
+var typesMu sync.RWMutex
+
+// Types registered by users.
 var typEncMap = make(map[reflect.Type]encoderFunc)
 var typDecMap = make(map[reflect.Type]decoderFunc)
 
+// Types registered by this package. Users can override them with Register.
+var builtinEncMap = make(map[reflect.Type]encoderFunc)
+var builtinDecMap = make(map[reflect.Type]decoderFunc)
+
+// fastPathTypes are types handled by Encoder.Encode and Decoder.Decode
+// without reflection.
+var fastPathTypes = []reflect.Type{
+	reflect.TypeOf(""),
+	reflect.TypeOf([]byte(nil)),
+	reflect.TypeOf(int(0)),
+	reflect.TypeOf(int8(0)),
+	reflect.TypeOf(int16(0)),
+	reflect.TypeOf(int32(0)),
+	reflect.TypeOf(int64(0)),
+	reflect.TypeOf(uint(0)),
+	reflect.TypeOf(uint8(0)),
+	reflect.TypeOf(uint16(0)),
+	reflect.TypeOf(uint32(0)),
+	reflect.TypeOf(uint64(0)),
+	reflect.TypeOf(false),
+	reflect.TypeOf(float32(0)),
+	reflect.TypeOf(float64(0)),
+	reflect.TypeOf([]string(nil)),
+	reflect.TypeOf(map[string]string(nil)),
+	reflect.TypeOf(map[string]interface{}(nil)),
+	reflect.TypeOf(time.Duration(0)),
+	reflect.TypeOf(time.Time{}),
+}
+
+// fastPathDisabled is set when any of fastPathTypes is registered by user.
+var fastPathDisabled int32
+
+func useFastPath() bool {
+	return atomic.LoadInt32(&fastPathDisabled) == 0
+}
+
 // Register registers encoder and decoder functions for a value.
 // This is low level API and in most cases you should prefer implementing
 // Marshaler/CustomEncoder and Unmarshaler/CustomDecoder interfaces.
+// Registered functions override encoding of built-in types, e.g. time.Time.
+// It is safe to call Register concurrently with encoding and decoding.
 func Register(value interface{}, enc encoderFunc, dec decoderFunc) {
 	typ := reflect.TypeOf(value)
+
+	typesMu.Lock()
 	if enc != nil {
 		typEncMap[typ] = enc
 	}
 	if dec != nil {
 		typDecMap[typ] = dec
 	}
+	typesMu.Unlock()
+
+	typesChanged()
+}
+
+// Deregister removes functions registered for a value with Register,
+// RegisterExt or RegisterName, restoring the default encoding of the type.
+// It is intended to be used in tests.
+func Deregister(value interface{}) {
+	typ := reflect.TypeOf(value)
+
+	typesMu.Lock()
+	if typ.Kind() == reflect.Ptr {
+		// RegisterExt registers *T as T.
+		for _, t := range extTypes {
+			if t == typ.Elem() {
+				typ = t
+				break
+			}
+		}
+	}
+	for id, t := range extTypes {
+		if t == typ {
+			delete(extTypes, id)
+			delete(typEncMap, reflect.PtrTo(typ))
+		}
+	}
+	if name, ok := typeNames[typ]; ok {
+		delete(typeNames, typ)
+		delete(namedTypes, name)
+	}
+	delete(typEncMap, typ)
+	delete(typDecMap, typ)
+	typesMu.Unlock()
+
+	typesChanged()
+}
+
+func registerBuiltin(typ reflect.Type, enc encoderFunc, dec decoderFunc) {
+	builtinEncMap[typ] = enc
+	builtinDecMap[typ] = dec
+}
+
+// typesChanged must be called after registered types are changed
+// to drop encoders and decoders cached for the old types.
+func typesChanged() {
+	typesMu.RLock()
+	var disabled int32
+	for _, typ := range fastPathTypes {
+		if _, ok := typEncMap[typ]; ok {
+			disabled = 1
+		}
+		if _, ok := typDecMap[typ]; ok {
+			disabled = 1
+		}
+	}
+	typesMu.RUnlock()
+
+	atomic.StoreInt32(&fastPathDisabled, disabled)
+	encoders.Reset()
+	decoders.Reset()
+	structs.Reset()
+}
+
+func registeredEncoder(typ reflect.Type) (encoderFunc, bool) {
+	typesMu.RLock()
+	enc, ok := typEncMap[typ]
+	typesMu.RUnlock()
+	if ok {
+		return enc, true
+	}
+	enc, ok = builtinEncMap[typ]
+	return enc, ok
+}
+
+func registeredDecoder(typ reflect.Type) (decoderFunc, bool) {
+	typesMu.RLock()
+	dec, ok := typDecMap[typ]
+	typesMu.RUnlock()
+	if ok {
+		return dec, true
+	}
+	dec, ok = builtinDecMap[typ]
+	return dec, ok
 }
 
 //------------------------------------------------------------------------------
 
 var structs = newStructCache()
 
+// structCache caches fields of struct types. Lookups don't take any locks:
+// the map is replaced with an updated copy when a new type is added.
+// Fields are built while holding the lock, so Reset can't be interleaved
+// with storing them.
 type structCache struct {
-	mu sync.RWMutex
-	m  map[reflect.Type]*fields
+	mu sync.Mutex // used by writers
+	m  atomic.Value
 }
 
 func newStructCache() *structCache {
-	return &structCache{
-		m: make(map[reflect.Type]*fields),
-	}
+	c := new(structCache)
+	c.m.Store(make(map[reflect.Type]*fields))
+	return c
 }
 
-func (m *structCache) Fields(typ reflect.Type) *fields {
-	m.mu.RLock()
-	fs, ok := m.m[typ]
-	m.mu.RUnlock()
-	if ok {
+func (c *structCache) Reset() {
+	c.mu.Lock()
+	c.m.Store(make(map[reflect.Type]*fields))
+	c.mu.Unlock()
+}
+
+func (c *structCache) Fields(typ reflect.Type) *fields {
+	if fs, ok := c.load()[typ]; ok {
 		return fs
 	}
 
-	m.mu.Lock()
-	fs, ok = m.m[typ]
-	if !ok {
-		fs = getFields(typ)
-		m.m[typ] = fs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := c.load()
+	if fs, ok := m[typ]; ok {
+		return fs
 	}
-	m.mu.Unlock()
+
+	fs := getFields(typ)
+	newm := make(map[reflect.Type]*fields, len(m)+1)
+	for k, v := range m {
+		newm[k] = v
+	}
+	newm[typ] = fs
+	c.m.Store(newm)
 
 	return fs
 }
 
+func (c *structCache) load() map[reflect.Type]*fields {
+	return c.m.Load().(map[reflect.Type]*fields)
+}
+
+//------------------------------------------------------------------------------
+
+var encoders = newEncoderCache()
+
+// encoderCache caches encoders of types. Like structCache it doesn't
+// take any locks for lookups.
+type encoderCache struct {
+	mu sync.Mutex // used by writers
+	m  atomic.Value
+	// gen is incremented by Reset. Encoders built before
+	// a Reset are returned but not cached.
+	gen uint64
+}
+
+func newEncoderCache() *encoderCache {
+	c := new(encoderCache)
+	c.m.Store(make(map[reflect.Type]encoderFunc))
+	return c
+}
+
+func (c *encoderCache) Reset() {
+	c.mu.Lock()
+	c.gen++
+	c.m.Store(make(map[reflect.Type]encoderFunc))
+	c.mu.Unlock()
+}
+
+func (c *encoderCache) Encoder(typ reflect.Type) encoderFunc {
+	if enc, ok := c.load()[typ]; ok {
+		return enc
+	}
+
+	// The encoder is built without holding the lock
+	// because building it may look up other types.
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+	enc := newEncoder(typ)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return enc
+	}
+	m := c.load()
+	if enc, ok := m[typ]; ok {
+		return enc
+	}
+	newm := make(map[reflect.Type]encoderFunc, len(m)+1)
+	for k, v := range m {
+		newm[k] = v
+	}
+	newm[typ] = enc
+	c.m.Store(newm)
+
+	return enc
+}
+
+func (c *encoderCache) load() map[reflect.Type]encoderFunc {
+	return c.m.Load().(map[reflect.Type]encoderFunc)
+}
+
+var decoders = newDecoderCache()
+
+// decoderCache caches decoders of types the same way
+// encoderCache caches encoders.
+type decoderCache struct {
+	mu  sync.Mutex // used by writers
+	m   atomic.Value
+	gen uint64
+}
+
+func newDecoderCache() *decoderCache {
+	c := new(decoderCache)
+	c.m.Store(make(map[reflect.Type]decoderFunc))
+	return c
+}
+
+func (c *decoderCache) Reset() {
+	c.mu.Lock()
+	c.gen++
+	c.m.Store(make(map[reflect.Type]decoderFunc))
+	c.mu.Unlock()
+}
+
+func (c *decoderCache) Decoder(typ reflect.Type) decoderFunc {
+	if dec, ok := c.load()[typ]; ok {
+		return dec
+	}
+
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+	dec := newDecoder(typ)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return dec
+	}
+	m := c.load()
+	if dec, ok := m[typ]; ok {
+		return dec
+	}
+	newm := make(map[reflect.Type]decoderFunc, len(m)+1)
+	for k, v := range m {
+		newm[k] = v
+	}
+	newm[typ] = dec
+	c.m.Store(newm)
+
+	return dec
+}
+
+func (c *decoderCache) load() map[reflect.Type]decoderFunc {
+	return c.m.Load().(map[reflect.Type]decoderFunc)
+}
+
 //------------------------------------------------------------------------------
 
+// field holds everything needed to encode and decode a struct field.
+// It is computed once per struct type.
 type field struct {
 	name      string
 	index     []int
 	omitEmpty bool
+	// encodedName is name encoded as a msgpack string
+	// with the default encoder options.
+	encodedName []byte
+	// id is the number from a numeric tag like `msgpack:"1"`
+	// or zero.
+	id int64
+
+	// pos is the index of the field in fields.List.
+	pos int
+	// required is set by the required tag option.
+	required bool
+
+	// defaultValue is set from the default= tag option.
+	defaultValue reflect.Value
+	defaultErr   error
 
 	encoder encoderFunc
 	decoder decoderFunc
+	// fixedInt is set when encoder is chosen by an integer tag option.
+	fixedInt bool
 }
 
 func (f *field) value(strct reflect.Value) reflect.Value {
@@ -96,8 +388,26 @@ func (f *field) DecodeValue(d *Decoder, strct reflect.Value) error {
 //------------------------------------------------------------------------------
 
 type fields struct {
+	// List holds fields in declaration order. Fields of inlined embedded
+	// structs take the place of the embedded field. The order is stable
+	// and is used to encode structs both as maps and as arrays.
 	List  []*field
 	Table map[string]*field
+	// Sorted holds the same fields as List sorted by name.
+	Sorted []*field
+	// Fold maps folded names to fields for case-insensitive lookups.
+	Fold map[string]*field
+	// IDs maps ids of fields with numeric tags to fields.
+	IDs map[int64]*field
+	// Required holds fields with the required tag option.
+	Required []*field
+	// Defaults holds fields with default= tag options.
+	Defaults []*field
+	// defaulter is true if pointer to the struct implements Defaulter.
+	defaulter bool
+	// idErr reports fields with the same numeric tag. Such structs
+	// can't be encoded or decoded as maps.
+	idErr error
 
 	asArray   bool
 	omitEmpty bool
@@ -114,28 +424,66 @@ func (fs *fields) Len() int {
 	return len(fs.List)
 }
 
-func (fs *fields) Add(field *field) {
-	fs.List = append(fs.List, field)
-	fs.Table[field.name] = field
-	if field.omitEmpty {
-		fs.omitEmpty = field.omitEmpty
+func (fs *fields) Add(f *field) {
+	f.pos = len(fs.List)
+	fs.List = append(fs.List, f)
+	fs.Table[f.name] = f
+	if f.id > 0 {
+		if fs.IDs == nil {
+			fs.IDs = make(map[int64]*field)
+		}
+		if prev, ok := fs.IDs[f.id]; ok {
+			if fs.idErr == nil {
+				fs.idErr = fmt.Errorf("msgpack: fields %v and %v have the same id %d",
+					prev.index, f.index, f.id)
+			}
+		} else {
+			fs.IDs[f.id] = f
+		}
+	}
+	if f.required {
+		fs.Required = append(fs.Required, f)
+	}
+	if f.defaultValue.IsValid() || f.defaultErr != nil {
+		fs.Defaults = append(fs.Defaults, f)
+	}
+	if f.omitEmpty {
+		fs.omitEmpty = f.omitEmpty
 	}
 }
 
-func (fs *fields) OmitEmpty(strct reflect.Value) []*field {
-	if !fs.omitEmpty {
-		return fs.List
+// Lookup returns the field with the name. If fold is true and there is
+// no exact match, names are compared ignoring case and underscores.
+func (fs *fields) Lookup(name string, fold bool) *field {
+	if f, ok := fs.Table[name]; ok {
+		return f
+	}
+	if fold {
+		return fs.Fold[foldName(name)]
 	}
+	return nil
+}
 
-	fields := make([]*field, 0, fs.Len())
-	for _, f := range fs.List {
-		if !f.Omit(strct) {
-			fields = append(fields, f)
-		}
+// fieldID returns the number name holds if it is a positive integer
+// in canonical form or zero.
+func fieldID(name string) int64 {
+	id, err := strconv.ParseInt(name, 10, 64)
+	if err != nil || id <= 0 || strconv.FormatInt(id, 10) != name {
+		return 0
 	}
-	return fields
+	return id
 }
 
+func foldName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+type fieldsByName []*field
+
+func (s fieldsByName) Len() int           { return len(s) }
+func (s fieldsByName) Less(i, j int) bool { return s[i].name < s[j].name }
+func (s fieldsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 func getFields(typ reflect.Type) *fields {
 	numField := typ.NumField()
 	fs := newFields(numField)
@@ -166,11 +514,21 @@ func getFields(typ reflect.Type) *fields {
 			name = f.Name
 		}
 		field := &field{
-			name:      name,
-			index:     f.Index,
-			omitEmpty: omitEmpty || opt.Contains("omitempty"),
-			encoder:   getEncoder(f.Type),
-			decoder:   getDecoder(f.Type),
+			name:        name,
+			index:       f.Index,
+			omitEmpty:   omitEmpty || opt.Contains("omitempty"),
+			encodedName: encodeFieldName(name),
+			id:          fieldID(name),
+			required:    opt.Contains("required"),
+			encoder:     getEncoder(f.Type),
+			decoder:     getDecoder(f.Type),
+		}
+		if enc := fixedIntEncoder(f.Type, opt); enc != nil {
+			field.encoder = enc
+			field.fixedInt = true
+		}
+		if s, ok := opt.Get("default="); ok {
+			field.defaultValue, field.defaultErr = parseDefault(f.Type, s)
 		}
 
 		if f.Anonymous && inlineFields(fs, f.Type, field) {
@@ -179,14 +537,31 @@ func getFields(typ reflect.Type) *fields {
 
 		fs.Add(field)
 	}
+
+	fs.defaulter = reflect.PtrTo(typ).Implements(defaulterType)
+
+	fs.Sorted = make([]*field, len(fs.List))
+	copy(fs.Sorted, fs.List)
+	sort.Stable(fieldsByName(fs.Sorted))
+
+	fs.Fold = make(map[string]*field, len(fs.List))
+	for _, f := range fs.List {
+		name := foldName(f.name)
+		if _, ok := fs.Fold[name]; !ok {
+			fs.Fold[name] = f
+		}
+	}
+
 	return fs
 }
 
-var encodeStructValuePtr uintptr
+// structEncoderPtr is the code pointer shared by struct encoders
+// returned by structEncoderFunc.
+var structEncoderPtr uintptr
 var decodeStructValuePtr uintptr
 
 func init() {
-	encodeStructValuePtr = reflect.ValueOf(encodeStructValue).Pointer()
+	structEncoderPtr = reflect.ValueOf(structEncoderFunc(nil)).Pointer()
 	decodeStructValuePtr = reflect.ValueOf(decodeStructValue).Pointer()
 }
 
@@ -208,7 +583,7 @@ func inlineFields(fs *fields, typ reflect.Type, f *field) bool {
 		}
 	}
 
-	if reflect.ValueOf(encoder).Pointer() != encodeStructValuePtr {
+	if reflect.ValueOf(encoder).Pointer() != structEncoderPtr {
 		return false
 	}
 	if reflect.ValueOf(decoder).Pointer() != decodeStructValuePtr {
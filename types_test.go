@@ -2,12 +2,16 @@ package msgpack_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"math"
+	"net"
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -123,6 +127,12 @@ var encoderTests = []encoderTest{
 	{[]byte(nil), "c0"},
 	{[]byte{1, 2, 3}, "c403010203"},
 	{[3]byte{1, 2, 3}, "c403010203"},
+	{[3]byteAlias{1, 2, 3}, "c403010203"},
+
+	{net.IP(nil), "c0"},
+	{net.ParseIP("1.2.3.4"), "c40401020304"},
+	{net.ParseIP("::1"), "c41000000000000000000000000000000001"},
+	{&url.URL{Scheme: "http", Host: "a"}, "a8687474703a2f2f61"},
 
 	{time.Unix(0, 0), "d6ff00000000"},
 	{time.Unix(1, 1), "d7ff0000000400000001"},
@@ -172,6 +182,190 @@ func TestEncoder(t *testing.T) {
 	}
 }
 
+func TestSortStructFields(t *testing.T) {
+	type T struct {
+		Z int
+		A int
+	}
+	in := &T{Z: 1, A: 2}
+
+	for _, test := range []struct {
+		sorted bool
+		wanted string
+	}{
+		{false, "82a15a01a14102"},
+		{true, "82a14102a15a01"},
+	} {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf).SortStructFields(test.sorted)
+		if err := enc.Encode(in); err != nil {
+			t.Fatal(err)
+		}
+
+		s := hex.EncodeToString(buf.Bytes())
+		if s != test.wanted {
+			t.Fatalf("%s != %s (sorted=%v)", s, test.wanted, test.sorted)
+		}
+	}
+}
+
+func TestCompatibleEncoding(t *testing.T) {
+	tm := time.Unix(1, 2)
+	in := []interface{}{"foo", strings.Repeat("x", 32), []byte{1}, tm}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf).UseCompatibleEncoding(true)
+	if err := enc.Encode(in...); err != nil {
+		t.Fatal(err)
+	}
+	wanted := "a3666f6f" + "da0020" + strings.Repeat("78", 32) + "a101" + "920102"
+	if s := hex.EncodeToString(buf.Bytes()); s != wanted {
+		t.Fatalf("%s != %s", s, wanted)
+	}
+
+	var s1, s2 string
+	var b []byte
+	var out time.Time
+	if err := msgpack.NewDecoder(&buf).Decode(&s1, &s2, &b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if s1 != in[0] || s2 != in[1] || !bytes.Equal(b, []byte{1}) || !out.Equal(tm) {
+		t.Fatalf("got %q %q %v %v", s1, s2, b, out)
+	}
+
+	buf.Reset()
+	if err := enc.UseCompatibleEncoding(false).Encode([]byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(buf.Bytes()); s != "c40101" {
+		t.Fatalf("%s != c40101", s)
+	}
+}
+
+type fixedIntTest struct {
+	A int    `msgpack:",as_int32"`
+	B int64  `msgpack:",as_uint16"`
+	C uint8  `msgpack:",fixed"`
+	D int16  `msgpack:",fixed64"`
+	E uint32 `msgpack:",as_int8"`
+}
+
+func TestFixedIntTags(t *testing.T) {
+	in := &fixedIntTest{A: 1, B: 2, C: 3, D: -4, E: 5}
+
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).StructAsArray(true).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	wanted := "95d200000001cd0002cc03d3fffffffffffffffcd005"
+	if s := hex.EncodeToString(buf.Bytes()); s != wanted {
+		t.Fatalf("%s != %s", s, wanted)
+	}
+
+	var out fixedIntTest
+	if err := msgpack.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != *in {
+		t.Fatalf("got %#v, wanted %#v", out, in)
+	}
+
+	in.E = 300
+	_, err := msgpack.Marshal(in)
+	if err == nil || err.Error() != "msgpack: 300 overflows int8" {
+		t.Fatalf("got %v, wanted overflow error", err)
+	}
+
+	_, err = msgpack.Marshal(&struct {
+		S string `msgpack:",fixed"`
+	}{})
+	if err == nil || err.Error() != `msgpack: invalid tag option "fixed" for string` {
+		t.Fatalf("got %v, wanted invalid tag error", err)
+	}
+}
+
+type sizedBlob struct {
+	n int
+}
+
+var _ msgpack.CustomEncoder = (*sizedBlob)(nil)
+var _ msgpack.Sizer = (*sizedBlob)(nil)
+
+func (b *sizedBlob) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.EncodeBytes(make([]byte, b.n))
+}
+
+func (b *sizedBlob) MsgpackSize() int {
+	return 42
+}
+
+func TestSizeOf(t *testing.T) {
+	for _, test := range encoderTests {
+		n, err := msgpack.SizeOf(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wanted := len(test.wanted) / 2; n != wanted {
+			t.Fatalf("got %d, wanted %d (in=%#v)", n, wanted, test.in)
+		}
+	}
+
+	n, err := msgpack.SizeOf([]*sizedBlob{{n: 1}, {n: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 85 {
+		t.Fatalf("got %d, wanted 85", n)
+	}
+}
+
+type sizeOfTest struct {
+	Name    string
+	Ints    []int64
+	Small   int8   `msgpack:",as_int64"`
+	Skipped string `msgpack:",omitempty"`
+	Blob    []byte
+	Arr     [3]uint16
+	Map     map[string]interface{}
+	Keys    map[sizeOfKey]float32
+	Time    time.Time
+	Next    *sizeOfTest
+}
+
+type sizeOfKey struct {
+	A int
+	B string
+}
+
+func TestSizeOfMatchesMarshal(t *testing.T) {
+	in := &sizeOfTest{
+		Name:  strings.Repeat("x", 300),
+		Ints:  []int64{-1, -33, -200, -40000, 1 << 40, 200, 70000},
+		Small: 1,
+		Blob:  make([]byte, 70000),
+		Arr:   [3]uint16{1, 300, 65535},
+		Map: map[string]interface{}{
+			"nil":   nil,
+			"slice": []interface{}{true, 1.5, "s"},
+			"map":   map[int]string{1: "a"},
+		},
+		Keys: map[sizeOfKey]float32{{A: 1, B: "b"}: 1},
+		Time: time.Unix(1, 2),
+		Next: &sizeOfTest{Name: "next"},
+	}
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := msgpack.SizeOf(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(b) {
+		t.Fatalf("got %d, wanted %d", n, len(b))
+	}
+}
+
 //------------------------------------------------------------------------------
 
 type decoderTest struct {
@@ -307,6 +501,9 @@ var (
 		{in: nil, out: new([3]byte), wanted: [3]byte{}},
 		{in: [3]byte{1, 2, 3}, out: new([3]byte)},
 		{in: [3]byte{1, 2, 3}, out: new([2]byte), decErr: "[2]uint8 len is 2, but msgpack has 3 elements"},
+		{in: [3]byteAlias{1, 2, 3}, out: new([3]byteAlias)},
+		{in: []byte{1, 2}, out: &[3]byte{7, 8, 9}, wanted: [3]byte{1, 2, 0}},
+		{in: []int{1, 2, 3}, out: new([3]byte), wanted: [3]byte{1, 2, 3}},
 
 		{in: nil, out: new([]interface{}), wantnil: true},
 		{in: nil, out: new([]interface{}), wantnil: true},
@@ -380,6 +577,13 @@ var (
 
 		{in: repoURL, out: new(url.URL)},
 		{in: repoURL, out: new(*url.URL)},
+		{in: map[string]interface{}{"Scheme": "http", "Host": "a"}, out: new(url.URL), wanted: url.URL{Scheme: "http", Host: "a"}},
+
+		{in: net.IP(nil), out: new(net.IP), wantnil: true},
+		{in: net.ParseIP("::1"), out: new(net.IP)},
+		{in: net.ParseIP("1.2.3.4"), out: new(net.IP), wanted: net.IPv4(1, 2, 3, 4).To4()},
+		{in: "1.2.3.4", out: new(net.IP), wanted: net.IPv4(1, 2, 3, 4)},
+		{in: "foo", out: new(net.IP), decErr: `msgpack: invalid IP address: "foo"`},
 
 		{in: nil, out: new(*AsArrayTest), wantnil: true},
 		{in: nil, out: new(AsArrayTest), wantzero: true},
@@ -483,3 +687,565 @@ func TestStrings(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterOverridesBuiltin(t *testing.T) {
+	type timeStruct struct {
+		T time.Time
+	}
+
+	tm := time.Unix(1e9, 0)
+	msgpack.Register(time.Time{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			return e.EncodeInt(v.Interface().(time.Time).Unix())
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			sec, err := d.DecodeInt64()
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(time.Unix(sec, 0)))
+			return nil
+		})
+
+	for _, in := range []interface{}{tm, &timeStruct{T: tm}} {
+		b, err := msgpack.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, []byte{0xce, 0x3b, 0x9a, 0xca, 0x00}) {
+			t.Fatalf("got %x, wanted time encoded as uint32", b)
+		}
+
+		out := reflect.New(reflect.TypeOf(in)).Interface()
+		if err := msgpack.Unmarshal(b, out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(indirect(out), indirect(in)) {
+			t.Fatalf("got %#v, wanted %#v", out, in)
+		}
+	}
+
+	msgpack.Deregister(time.Time{})
+
+	b, err := msgpack.Marshal(&timeStruct{T: tm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := hex.EncodeToString(b)
+	wanted := "81a154d6ff3b9aca00"
+	if s != wanted {
+		t.Fatalf("got %s, wanted %s", s, wanted)
+	}
+}
+
+type point struct {
+	X, Y int
+}
+
+type points []point
+
+type tree []tree
+
+func TestCodecCache(t *testing.T) {
+	in := points{{X: 1, Y: 2}}
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(b); s != "9182a15801a15902" {
+		t.Fatalf("got %s", s)
+	}
+
+	var out points
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Registering the element type must drop the cached slice coders.
+	msgpack.Register(point{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			p := v.Interface().(point)
+			return e.EncodeString(fmt.Sprintf("%d,%d", p.X, p.Y))
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			s, err := d.DecodeString()
+			if err != nil {
+				return err
+			}
+			var p point
+			if _, err := fmt.Sscanf(s, "%d,%d", &p.X, &p.Y); err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(p))
+			return nil
+		})
+	defer msgpack.Deregister(point{})
+
+	b, err = msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(b); s != "91a3312c32" {
+		t.Fatalf("got %s", s)
+	}
+
+	out = nil
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0] != (point{X: 1, Y: 2}) {
+		t.Fatalf("got %v", out)
+	}
+
+	b, err = msgpack.Marshal(tree{tree{}, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(b); s != "9290c0" {
+		t.Fatalf("got %s", s)
+	}
+	var tr tree
+	if err := msgpack.Unmarshal(b, &tr); err != nil {
+		t.Fatal(err)
+	}
+	if len(tr) != 2 || tr[0] == nil || tr[1] != nil {
+		t.Fatalf("got %#v", tr)
+	}
+}
+
+func TestPreencodedFieldNames(t *testing.T) {
+	type longName struct {
+		A int `msgpack:"abcdefghijklmnopqrstuvwxyz0123456789"`
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	if err := enc.Encode(longName{A: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(buf.Bytes()[:3]); s != "81d924" {
+		t.Fatalf("got %s, wanted str8 key", s)
+	}
+
+	buf.Reset()
+	if err := enc.UseCompatibleEncoding(true).Encode(longName{A: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(buf.Bytes()[:4]); s != "81da0024" {
+		t.Fatalf("got %s, wanted str16 key", s)
+	}
+}
+
+type intKeysV1 struct {
+	Name  string `msgpack:"1"`
+	Email string `msgpack:"2"`
+	Age   int
+}
+
+type intKeysV2 struct {
+	FullName string `msgpack:"1"`
+	Age      int
+	Mail     string `msgpack:"2"`
+}
+
+func TestIntKeys(t *testing.T) {
+	in := intKeysV1{Name: "a", Email: "b", Age: 3}
+
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).UseIntKeys(true).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	wanted := "83" + "01a161" + "02a162" + "a341676503"
+	if s := hex.EncodeToString(buf.Bytes()); s != wanted {
+		t.Fatalf("%s != %s", s, wanted)
+	}
+
+	var out intKeysV2
+	if err := msgpack.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != (intKeysV2{FullName: "a", Age: 3, Mail: "b"}) {
+		t.Fatalf("got %#v", out)
+	}
+
+	// Without the option numeric tags are plain names.
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = intKeysV2{}
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != (intKeysV2{FullName: "a", Age: 3, Mail: "b"}) {
+		t.Fatalf("got %#v", out)
+	}
+
+	// Int and string forms of the same key are duplicates.
+	b, err = hex.DecodeString("8201a161a131a162")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(b)).DisallowDuplicateKeys(true)
+	if err := dec.Decode(&out); err == nil {
+		t.Fatal("got nil error, wanted duplicate key")
+	}
+}
+
+func TestIntKeysInterface(t *testing.T) {
+	in := intKeysV1{Name: "a", Email: "b", Age: 3}
+
+	var buf bytes.Buffer
+	if err := msgpack.NewEncoder(&buf).UseIntKeys(true).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+
+	var out interface{}
+	if err := msgpack.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	wanted := map[interface{}]interface{}{
+		int64(1): "a",
+		int64(2): "b",
+		"Age":    int64(3),
+	}
+	if !reflect.DeepEqual(out, wanted) {
+		t.Fatalf("got %#v, wanted %#v", out, wanted)
+	}
+}
+
+type intKeysDup struct {
+	A int `msgpack:"1"`
+	B int `msgpack:"1"`
+}
+
+func TestIntKeysDuplicateID(t *testing.T) {
+	wanted := "msgpack: fields [0] and [1] have the same id 1"
+
+	err := msgpack.NewEncoder(ioutil.Discard).UseIntKeys(true).Encode(intKeysDup{})
+	if err == nil || err.Error() != wanted {
+		t.Fatalf("got %v, wanted %q", err, wanted)
+	}
+
+	b, err := msgpack.Marshal(map[int]int{1: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out intKeysDup
+	err = msgpack.Unmarshal(b, &out)
+	if err == nil || err.Error() != wanted {
+		t.Fatalf("got %v, wanted %q", err, wanted)
+	}
+}
+
+type tenantKey struct{}
+
+type secret string
+
+func TestRegisterContext(t *testing.T) {
+	xor := func(ctx context.Context, s string) string {
+		key := ctx.Value(tenantKey{}).(byte)
+		b := []byte(s)
+		for i := range b {
+			b[i] ^= key
+		}
+		return string(b)
+	}
+	msgpack.RegisterContext(secret(""),
+		func(ctx context.Context, e *msgpack.Encoder, v reflect.Value) error {
+			return e.EncodeString(xor(ctx, v.String()))
+		},
+		func(ctx context.Context, d *msgpack.Decoder, v reflect.Value) error {
+			s, err := d.DecodeString()
+			if err != nil {
+				return err
+			}
+			v.SetString(xor(ctx, s))
+			return nil
+		})
+	defer msgpack.Deregister(secret(""))
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, byte(1))
+
+	var buf bytes.Buffer
+	in := map[string]secret{"password": "abc"}
+	if err := msgpack.NewEncoder(&buf).WithContext(ctx).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("`cb")) {
+		t.Fatalf("got %q, wanted encrypted value", buf.Bytes())
+	}
+
+	var out map[string]secret
+	if err := msgpack.NewDecoder(&buf).WithContext(ctx).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got %v, wanted %v", out, in)
+	}
+}
+
+func TestRegisterConcurrently(t *testing.T) {
+	type item struct {
+		Foo string
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b, err := msgpack.Marshal(&item{Foo: "bar"})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var out item
+				if err := msgpack.Unmarshal(b, &out); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				msgpack.Register(Exported{}, nil, nil)
+				msgpack.Deregister(Exported{})
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type cachedID int
+
+type cachedFields struct {
+	ID cachedID
+}
+
+func TestStructFieldsIndexIsCopied(t *testing.T) {
+	typ := reflect.TypeOf(sizeOfKey{})
+	fields, _ := msgpack.StructFields(typ)
+	fields[1].Index[0] = 0
+
+	b, err := msgpack.Marshal(sizeOfKey{A: 1, B: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["B"] != "b" {
+		t.Fatalf("got %v, wanted B=b", out)
+	}
+	if fields, _ := msgpack.StructFields(typ); fields[1].Index[0] != 1 {
+		t.Fatalf("got index %v, wanted [1]", fields[1].Index)
+	}
+}
+
+func TestRegisterInvalidatesStructFields(t *testing.T) {
+	encodeID := func(e *msgpack.Encoder, v reflect.Value) error {
+		return e.EncodeString(fmt.Sprintf("id%d", v.Int()))
+	}
+	decodeID := func(d *msgpack.Decoder, v reflect.Value) error {
+		s, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+		var n int64
+		if _, err := fmt.Sscanf(s, "id%d", &n); err != nil {
+			return err
+		}
+		v.SetInt(n)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b, err := msgpack.Marshal(cachedFields{ID: 1})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var out cachedFields
+				// Types may change between the calls.
+				_ = msgpack.Unmarshal(b, &out)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				msgpack.Register(cachedID(0), encodeID, decodeID)
+				msgpack.Deregister(cachedID(0))
+			}
+		}()
+	}
+	wg.Wait()
+
+	msgpack.Register(cachedID(0), encodeID, decodeID)
+	b, err := msgpack.Marshal(cachedFields{ID: 1})
+	msgpack.Deregister(cachedID(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(b); s != "81a24944a3696431" {
+		t.Fatalf("got %s", s)
+	}
+
+	b, err = msgpack.Marshal(cachedFields{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := hex.EncodeToString(b); s != "81a2494401" {
+		t.Fatalf("got %s", s)
+	}
+}
+
+type defaultsTest struct {
+	Name    string        `msgpack:",default=anon"`
+	Port    int           `msgpack:",default=8080"`
+	Ratio   float64       `msgpack:",default=0.5"`
+	Enabled bool          `msgpack:",default=true"`
+	Timeout time.Duration `msgpack:",default=1m30s"`
+	Hosts   []string
+}
+
+func (t *defaultsTest) SetDefaults() {
+	t.Hosts = []string{"localhost"}
+}
+
+type badDefault struct {
+	N int `msgpack:",default=x"`
+}
+
+func TestDefaults(t *testing.T) {
+	b, err := msgpack.Marshal(map[string]interface{}{"Port": 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out defaultsTest
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	wanted := defaultsTest{
+		Name:    "anon",
+		Port:    80,
+		Ratio:   0.5,
+		Enabled: true,
+		Timeout: 90 * time.Second,
+		Hosts:   []string{"localhost"},
+	}
+	if !reflect.DeepEqual(out, wanted) {
+		t.Fatalf("got %#v, wanted %#v", out, wanted)
+	}
+
+	// Present values win over defaults, even zero ones.
+	b, err = msgpack.Marshal(defaultsTest{Hosts: []string{"a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = defaultsTest{}
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, defaultsTest{Hosts: []string{"a"}}) {
+		t.Fatalf("got %#v", out)
+	}
+
+	// Defaults don't overwrite values of absent fields set beforehand.
+	b, err = msgpack.Marshal(map[string]interface{}{"Name": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = defaultsTest{Port: 8080}
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Port != 8080 || out.Ratio != 0.5 {
+		t.Fatalf("got %#v", out)
+	}
+
+	var bad badDefault
+	err = msgpack.Unmarshal([]byte{0x80}, &bad)
+	if err == nil || !strings.Contains(err.Error(), `invalid default "x"`) {
+		t.Fatalf("got %v, wanted invalid default error", err)
+	}
+}
+
+type requiredItem struct {
+	ID   int    `msgpack:"id,required"`
+	Name string `msgpack:"name,required"`
+}
+
+type requiredOrder struct {
+	Customer string `msgpack:",required"`
+	Items    []requiredItem
+	Note     string
+}
+
+func TestRequiredFields(t *testing.T) {
+	in := map[string]interface{}{
+		"Items": []interface{}{
+			map[string]interface{}{"id": 1, "name": "a"},
+			map[string]interface{}{"id": 2},
+		},
+		"Note": "x",
+	}
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out requiredOrder
+	err = msgpack.Unmarshal(b, &out)
+	reqErr, ok := err.(*msgpack.RequiredFieldsError)
+	if !ok {
+		t.Fatalf("got %v, wanted *RequiredFieldsError", err)
+	}
+	wanted := []string{"Items[1].name", "Customer"}
+	if !reflect.DeepEqual(reqErr.Paths, wanted) {
+		t.Fatalf("got %q, wanted %q", reqErr.Paths, wanted)
+	}
+	// Decoding continues after missing fields.
+	if out.Note != "x" || len(out.Items) != 2 || out.Items[1].ID != 2 {
+		t.Fatalf("got %#v", out)
+	}
+
+	b, err = msgpack.Marshal(requiredOrder{Customer: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type DefaultsInner struct {
+	X int `msgpack:",default=5"`
+}
+
+func TestDefaultsEmbeddedPtr(t *testing.T) {
+	type outer struct {
+		*DefaultsInner
+		Y int
+	}
+
+	b, err := msgpack.Marshal(map[string]interface{}{"Y": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out outer
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Y != 1 || out.DefaultsInner == nil || out.X != 5 {
+		t.Fatalf("got %#v", out)
+	}
+}
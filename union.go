@@ -0,0 +1,88 @@
+package msgpack
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Union is a registry of types that form a discriminated union.
+// Values are encoded as 2-element arrays [tag, value] and decoded
+// by looking up the tag in the registry.
+type Union struct {
+	types map[string]reflect.Type
+	tags  map[reflect.Type]string
+}
+
+// NewUnion returns an empty Union. Types are added with Register.
+func NewUnion() *Union {
+	return &Union{
+		types: make(map[string]reflect.Type),
+		tags:  make(map[reflect.Type]string),
+	}
+}
+
+// Register records a type, identified by a value for that type,
+// under the provided tag. Only the exact type is registered: if value
+// is a pointer, decoded values are pointers as well. It panics if the
+// mapping between types and tags is not a bijection.
+func (u *Union) Register(tag string, value interface{}) *Union {
+	typ := reflect.TypeOf(value)
+	if _, ok := u.types[tag]; ok {
+		panic(fmt.Errorf("msgpack: union tag %q is already registered", tag))
+	}
+	if _, ok := u.tags[typ]; ok {
+		panic(fmt.Errorf("msgpack: union type %s is already registered", typ))
+	}
+	u.types[tag] = typ
+	u.tags[typ] = tag
+	return u
+}
+
+// Encode encodes v as [tag, v] where tag is the tag v's type is registered with.
+// Nil values are encoded as nil.
+func (u *Union) Encode(e *Encoder, v interface{}) error {
+	if v == nil {
+		return e.EncodeNil()
+	}
+	tag, ok := u.tags[reflect.TypeOf(v)]
+	if !ok {
+		return fmt.Errorf("msgpack: type %T is not registered in union", v)
+	}
+	if err := e.EncodeArrayLen(2); err != nil {
+		return err
+	}
+	if err := e.EncodeString(tag); err != nil {
+		return err
+	}
+	return e.Encode(v)
+}
+
+// Decode decodes [tag, value] and returns value decoded into
+// the type registered with the tag.
+func (u *Union) Decode(d *Decoder) (interface{}, error) {
+	n, err := d.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+	if n == -1 {
+		return nil, nil
+	}
+	if n != 2 {
+		return nil, fmt.Errorf("msgpack: invalid union array len=%d, wanted 2", n)
+	}
+
+	tag, err := d.DecodeString()
+	if err != nil {
+		return nil, err
+	}
+	typ, ok := u.types[tag]
+	if !ok {
+		return nil, fmt.Errorf("msgpack: unknown union tag %q", tag)
+	}
+
+	v := reflect.New(typ).Elem()
+	if err := d.DecodeValue(v); err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
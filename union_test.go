@@ -0,0 +1,127 @@
+package msgpack_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+func newTestUnion() *msgpack.Union {
+	return msgpack.NewUnion().
+		Register("opened", AccountOpened{}).
+		Register("deposited", &MoneyDeposited{})
+}
+
+func TestUnion(t *testing.T) {
+	u := newTestUnion()
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	for _, v := range []interface{}{AccountOpened{Owner: "bob"}, &MoneyDeposited{Amount: 10}, nil} {
+		if err := u.Encode(enc, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := msgpack.NewDecoder(&buf)
+	v, err := u.Decode(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != (AccountOpened{Owner: "bob"}) {
+		t.Fatalf("got %#v", v)
+	}
+
+	v, err = u.Decode(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dep, ok := v.(*MoneyDeposited); !ok || dep.Amount != 10 {
+		t.Fatalf("got %#v", v)
+	}
+
+	v, err = u.Decode(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		t.Fatalf("got %#v, wanted nil", v)
+	}
+}
+
+func TestUnionEncodeUnregistered(t *testing.T) {
+	u := newTestUnion()
+
+	// Only the exact registered type is accepted.
+	err := u.Encode(msgpack.NewEncoder(new(bytes.Buffer)), MoneyDeposited{})
+	if err == nil {
+		t.Fatal("got nil error")
+	}
+	wanted := "msgpack: type msgpack_test.MoneyDeposited is not registered in union"
+	if err.Error() != wanted {
+		t.Fatalf("got %q, wanted %q", err, wanted)
+	}
+}
+
+func TestUnionDecodeErrors(t *testing.T) {
+	tests := []struct {
+		in     []interface{}
+		wanted string
+	}{
+		{
+			in:     []interface{}{"closed", AccountOpened{}},
+			wanted: `msgpack: unknown union tag "closed"`,
+		},
+		{
+			in:     []interface{}{"opened"},
+			wanted: "msgpack: invalid union array len=1, wanted 2",
+		},
+		{
+			in:     []interface{}{"deposited", map[string]interface{}{"Amount": "ten"}},
+			wanted: "msgpack: invalid code=a3 decoding int64",
+		},
+	}
+
+	u := newTestUnion()
+	for _, test := range tests {
+		b, err := msgpack.Marshal(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = u.Decode(msgpack.NewDecoder(bytes.NewReader(b)))
+		if err == nil {
+			t.Fatalf("%v: got nil error", test.in)
+		}
+		if err.Error() != test.wanted {
+			t.Fatalf("%v: got %q, wanted %q", test.in, err, test.wanted)
+		}
+	}
+}
+
+func TestUnionRegisterPanics(t *testing.T) {
+	tests := []struct {
+		tag    string
+		value  interface{}
+		wanted string
+	}{
+		{"opened", MoneyDeposited{}, `msgpack: union tag "opened" is already registered`},
+		{"created", AccountOpened{}, "msgpack: union type msgpack_test.AccountOpened is already registered"},
+	}
+
+	for _, test := range tests {
+		func() {
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatalf("panic expected")
+				}
+				got := r.(error).Error()
+				if got != test.wanted {
+					t.Fatalf("got %q, wanted %q", got, test.wanted)
+				}
+			}()
+			newTestUnion().Register(test.tag, test.value)
+		}()
+	}
+}
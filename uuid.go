@@ -0,0 +1,142 @@
+package msgpack
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/codes"
+)
+
+var uuidExtId int8 = -127
+
+// UUID is a universally unique identifier. It is encoded as fixext16,
+// which takes 18 bytes compared to 38 bytes taken by the string form.
+type UUID [16]byte
+
+func init() {
+	uuidType := reflect.TypeOf((*UUID)(nil)).Elem()
+	registerBuiltin(uuidType, encodeUUIDValue, decodeUUIDValue)
+}
+
+// ParseUUID parses UUID in the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+// or as 32 hex digits without hyphens.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+
+	b := []byte(s)
+	if len(b) == 36 {
+		digits := b[:0]
+		for i, ch := range b {
+			switch i {
+			case 8, 13, 18, 23:
+				if ch != '-' {
+					return u, fmt.Errorf("msgpack: invalid UUID: %q", s)
+				}
+			default:
+				digits = append(digits, ch)
+			}
+		}
+		b = digits
+	}
+	if len(b) != 32 {
+		return u, fmt.Errorf("msgpack: invalid UUID: %q", s)
+	}
+	if _, err := hex.Decode(u[:], b); err != nil {
+		return u, fmt.Errorf("msgpack: invalid UUID: %q", s)
+	}
+	return u, nil
+}
+
+// String returns UUID in the canonical form.
+func (u UUID) String() string {
+	b := make([]byte, 36)
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b)
+}
+
+func (e *Encoder) EncodeUUID(u UUID) error {
+	if err := e.writeCode(codes.FixExt16); err != nil {
+		return err
+	}
+	if err := e.w.WriteByte(byte(uuidExtId)); err != nil {
+		return err
+	}
+	return e.write(u[:])
+}
+
+// DecodeUUID decodes UUID encoded as fixext16. Bin with 16 bytes
+// and strings accepted by ParseUUID are supported as well.
+func (d *Decoder) DecodeUUID() (UUID, error) {
+	var u UUID
+
+	c, err := d.readCode()
+	if err != nil {
+		return u, err
+	}
+
+	switch {
+	case c == codes.Nil:
+		return u, nil
+	case codes.IsExt(c):
+		n, err := d.parseExtLen(c)
+		if err != nil {
+			return u, err
+		}
+		id, err := d.readCode()
+		if err != nil {
+			return u, err
+		}
+		if int8(id) != uuidExtId {
+			return u, fmt.Errorf("msgpack: invalid ext id=%d decoding UUID", int8(id))
+		}
+		return d.uuid(n)
+	case isStringCode(c):
+		s, err := d.string(c)
+		if err != nil {
+			return u, err
+		}
+		return ParseUUID(s)
+	default:
+		n, err := d.bytesLen(c)
+		if err != nil {
+			return u, err
+		}
+		if n != len(u) {
+			return u, fmt.Errorf("msgpack: invalid bin len=%d decoding UUID", n)
+		}
+		err = d.readFull(u[:])
+		return u, err
+	}
+}
+
+// uuid decodes the ext payload of extLen bytes.
+func (d *Decoder) uuid(extLen int) (UUID, error) {
+	var u UUID
+	if extLen != len(u) {
+		return u, fmt.Errorf("msgpack: invalid ext len=%d decoding UUID", extLen)
+	}
+	err := d.readFull(u[:])
+	return u, err
+}
+
+func encodeUUIDValue(e *Encoder, v reflect.Value) error {
+	return e.EncodeUUID(v.Interface().(UUID))
+}
+
+func decodeUUIDValue(d *Decoder, v reflect.Value) error {
+	u, err := d.DecodeUUID()
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(u))
+	return nil
+}
@@ -0,0 +1,98 @@
+package msgpack_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/vmihailenco/msgpack"
+)
+
+type googleUUID [16]byte
+
+func init() {
+	msgpack.RegisterExt(10, googleUUID{})
+}
+
+func TestUUID(t *testing.T) {
+	const s = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	u, err := msgpack.ParseUUID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.String() != s {
+		t.Fatalf("got %s, wanted %s", u, s)
+	}
+
+	b, err := msgpack.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := "d881" + "6ba7b8109dad11d180b400c04fd430c8"
+	if got := hex.EncodeToString(b); got != wanted {
+		t.Fatalf("got %s, wanted %s", got, wanted)
+	}
+
+	var iface interface{}
+	if err := msgpack.Unmarshal(b, &iface); err != nil {
+		t.Fatal(err)
+	}
+	if iface != u {
+		t.Fatalf("got %#v, wanted %s", iface, u)
+	}
+
+	for _, in := range []interface{}{u, s, u[:]} {
+		b, err := msgpack.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out msgpack.UUID
+		if err := msgpack.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out != u {
+			t.Fatalf("got %s, wanted %s", out, u)
+		}
+	}
+}
+
+func TestParseUUIDInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"6ba7b810-9dad-11d1-80b4-00c04fd430c",
+		"6ba7b810_9dad_11d1_80b4_00c04fd430c8",
+		"zba7b8109dad11d180b400c04fd430c8",
+	} {
+		if _, err := msgpack.ParseUUID(s); err == nil {
+			t.Fatalf("got nil, wanted error (s=%q)", s)
+		}
+	}
+}
+
+func TestRegisterExtByteArray(t *testing.T) {
+	in := googleUUID{0: 1, 15: 2}
+
+	b, err := msgpack.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := "d80a" + "01000000000000000000000000000002"
+	if got := hex.EncodeToString(b); got != wanted {
+		t.Fatalf("got %s, wanted %s", got, wanted)
+	}
+
+	var iface interface{}
+	if err := msgpack.Unmarshal(b, &iface); err != nil {
+		t.Fatal(err)
+	}
+	if iface != in {
+		t.Fatalf("got %#v, wanted %#v", iface, in)
+	}
+
+	var out googleUUID
+	if err := msgpack.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Fatalf("got %#v, wanted %#v", out, in)
+	}
+}